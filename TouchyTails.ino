@@ -6,6 +6,23 @@
 #define SERVICE_UUID        "0000ab00-0000-1000-8000-00805f9b34fb"
 #define CHARACTERISTIC_UUID "0000ab01-0000-1000-8000-00805f9b34fb"
 #define CHARACTERISTIC_SIZE 100
+// ADC pin wired to the battery through a 1:2 voltage divider, -1 if the
+// board has none. Without it no Battery service is offered and the app
+// doesn't report a battery level.
+#define BATTERY_PIN         -1
+#define BATTERY_EMPTY_MV    3300 // cell voltage reported as 0%
+#define BATTERY_FULL_MV     4200 // cell voltage reported as 100%
+
+// ==== PROTOCOL ====
+// The app writes a value "0.00".."1.00" as text. A value holds for
+// durationLimit and then fades to zero unless it is sent again.
+// "0" is the stop command the app sends when it shuts down or on Stop All:
+// output goes off right away. Anything else that does not parse to a
+// value above zero, such as the app's "ping" heartbeat, is ignored.
+// Devices flashed before the stop command was added ignore "0" and keep
+// running until durationLimit passes, so they need to be reflashed.
+// With BATTERY_PIN set, the standard Battery service (0x180F) reports the
+// charge in percent through its Battery Level characteristic (0x2A19).
 
 // ==== BLE Elements ====
 BLEService Service(SERVICE_UUID);
@@ -15,11 +32,15 @@ BLEStringCharacteristic Characteristic(
   CHARACTERISTIC_SIZE
 );
 BLEDescriptor CharacteristicDescriptor("2901", "Data");
+BLEService BatteryService("180F");
+BLEUnsignedCharCharacteristic BatteryLevel("2A19", BLERead | BLENotify);
 
 // ==== STATE ====
 float currentValue = 0.0;      // current output value [0..1]
 unsigned long lastUpdate = 0;  // millis when last update arrived
 const unsigned long durationLimit = 500; // ms until output goes to zero
+unsigned long lastBattery = 0; // millis when the battery was last read
+const unsigned long batteryInterval = 60000; // ms between battery reads
 
 // ==== SETUP ====
 
@@ -55,6 +76,11 @@ void initBLE() {
   Characteristic.addDescriptor(CharacteristicDescriptor);
   Service.addCharacteristic(Characteristic);
   BLE.addService(Service);
+  if (BATTERY_PIN >= 0) {
+    BatteryService.addCharacteristic(BatteryLevel);
+    BLE.addService(BatteryService);
+    BatteryLevel.writeValue(readBattery());
+  }
 
   // Setup handler for writes from central
   Characteristic.setEventHandler(BLEWritten, onWrite);
@@ -72,8 +98,15 @@ void initBLE() {
 // ==== BLE Event ====
 void handleData(String data) {
   
+  data.trim();
+  if (data == "0") { // stop command: silence right away
+    currentValue = 0.0;
+    applyOutput(currentValue);
+    return;
+  }
+
   float value = data.toFloat();
-  if(value <= 0)return; // no output for zero
+  if(value <= 0)return; // no output for zero or non-numeric data (ping)
   value = constrain(value, 0, 1.0); // clamp to [0,1]
   currentValue = value;  // store current value
   lastUpdate = millis();
@@ -112,6 +145,15 @@ void applyOutput(float value) {
   }
 }
 
+// ==== BATTERY ====
+// readBattery returns the charge in percent, estimated linearly from the
+// cell voltage
+uint8_t readBattery() {
+  long mv = analogReadMilliVolts(BATTERY_PIN) * 2; // undo the divider
+  long percent = (mv - BATTERY_EMPTY_MV) * 100 / (BATTERY_FULL_MV - BATTERY_EMPTY_MV);
+  return (uint8_t)constrain(percent, 0, 100);
+}
+
 // ==== MAIN LOOP ====
 void loop() {
   BLE.poll();
@@ -123,5 +165,10 @@ void loop() {
     currentValue = 0.0;
     applyOutput(currentValue);
   }
+
+  if (BATTERY_PIN >= 0 && now - lastBattery >= batteryInterval) {
+    lastBattery = now;
+    BatteryLevel.writeValue(readBattery());
+  }
   delay(100);
 }
@@ -0,0 +1,133 @@
+// api.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"touchytails/apiserver"
+	"touchytails/devicestore"
+	"touchytails/logstore"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- Local API ---
+
+const (
+	apiHost        = "127.0.0.1"
+	defaultAPIPort = 8765
+)
+
+var (
+	apiMu   sync.Mutex
+	apiStop func() // stops the running API server and waits until its port is free, nil if off
+)
+
+// apiPort returns the configured API port
+func apiPort() int {
+	if port := store.Settings().APIPort; port > 0 {
+		return port
+	}
+	return defaultAPIPort
+}
+
+// startAPI (re)starts the local API as the settings say, stopping the
+// server already running
+func startAPI(console *Console) {
+	apiMu.Lock()
+	defer apiMu.Unlock()
+	if apiStop != nil {
+		apiStop()
+		apiStop = nil
+	}
+	st := store.Settings()
+	if !st.APIEnabled {
+		return
+	}
+	if st.APIToken == "" {
+		store.UpdateSettings(func(st *devicestore.Settings) { st.APIToken = apiserver.NewToken() })
+		st = store.Settings()
+	}
+
+	addr := fmt.Sprintf("%s:%d", apiHost, apiPort())
+	srv := apiserver.New(addr, st.APIToken, store, output, bus)
+	if err := srv.Listen(); err != nil {
+		console.Log(logstore.LevelError, "", "api", "Local API failed: "+err.Error())
+		return
+	}
+	ctx, cancel := context.WithCancel(appCtx)
+	done := make(chan struct{})
+	// A restart on the same port can only listen once Serve has closed it
+	apiStop = func() {
+		cancel()
+		<-done
+	}
+	console.Log(logstore.LevelInfo, "", "api", "Local API listening on http://"+addr)
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		defer close(done)
+		if err := srv.Serve(ctx); err != nil {
+			console.Log(logstore.LevelError, "", "api", "Local API stopped: "+err.Error())
+		}
+	}()
+}
+
+// showAPISettings lets the user switch the local API on and off, pick its
+// port and see or renew its token
+func showAPISettings(console *Console) {
+	st := store.Settings()
+	enabled := widget.NewCheck("Enable the local API", nil)
+	enabled.SetChecked(st.APIEnabled)
+
+	port := widget.NewEntry()
+	port.SetText(strconv.Itoa(apiPort()))
+	port.Validator = func(text string) error {
+		_, err := parsePort(text)
+		return err
+	}
+
+	token := widget.NewEntry()
+	token.SetText(st.APIToken)
+	token.SetPlaceHolder("Created when the API is enabled")
+	token.Disable()
+	newToken := widget.NewButton("New token", func() { token.SetText(apiserver.NewToken()) })
+	copyToken := widget.NewButton("Copy", func() {
+		fyne.CurrentApp().Clipboard().SetContent(token.Text)
+	})
+
+	help := widget.NewLabel("Tools on this computer can list and control devices over HTTP\n" +
+		"at http://" + apiHost + ":<port>/api/. Send the token as\n" +
+		"\"Authorization: Bearer <token>\" or as ?token=<token>.")
+
+	dialog.ShowForm("Local API", "Save", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("", enabled),
+			widget.NewFormItem("Port", port),
+			widget.NewFormItem("Token", container.NewBorder(nil, nil, nil, container.NewHBox(newToken, copyToken), token)),
+			widget.NewFormItem("", help),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			p, _ := parsePort(port.Text)
+			store.UpdateSettings(func(st *devicestore.Settings) {
+				st.APIEnabled = enabled.Checked
+				st.APIPort = p
+				if token.Text != "" {
+					st.APIToken = token.Text
+				}
+			})
+			if st.APIEnabled && !enabled.Checked {
+				console.Log(logstore.LevelInfo, "", "api", "Local API off")
+			}
+			startAPI(console)
+		}, mainWindow)
+}
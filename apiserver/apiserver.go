@@ -0,0 +1,317 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"touchytails/blemanager"
+	"touchytails/devicestore"
+	"touchytails/eventbus"
+	"touchytails/outputmanager"
+)
+
+// maxDuration caps how long one API call may hold a device on
+const maxDuration = 60 * time.Second
+
+// Server is the opt-in local control API. It offers a REST API on top of
+// the device store and the output manager, and a WebSocket stream of bus
+// events. Every request needs the token, either as
+// "Authorization: Bearer <token>" or, for clients that can't set headers,
+// as the token query parameter.
+type Server struct {
+	Addr   string
+	token  string
+	store  *devicestore.DeviceStore
+	output *outputmanager.OutputManager
+	bus    *eventbus.Bus
+	ctx    context.Context // ends long-lived requests such as event streams
+	ln     net.Listener
+}
+
+// New creates a Server for addr, which should be a loopback address
+func New(addr, token string, store *devicestore.DeviceStore, output *outputmanager.OutputManager, bus *eventbus.Bus) *Server {
+	return &Server{
+		Addr:   addr,
+		token:  token,
+		store:  store,
+		output: output,
+		bus:    bus,
+		ctx:    context.Background(),
+	}
+}
+
+// NewToken returns a random token for API clients
+func NewToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Listen binds the TCP port
+func (s *Server) Listen() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", s.Addr, err)
+	}
+	s.ln = ln
+	return nil
+}
+
+// Serve answers requests on the port opened by Listen until ctx is
+// cancelled, then closes open event streams and returns nil
+func (s *Server) Serve(ctx context.Context) error {
+	if s.ln == nil {
+		return errors.New("apiserver: Serve called before Listen")
+	}
+	s.ctx = ctx
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.Serve(s.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns the API routes behind the token check
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/devices", s.listDevices)
+	mux.HandleFunc("GET /api/devices/{ref}", s.getDevice)
+	mux.HandleFunc("PUT /api/devices/{ref}/enabled", s.setEnabled)
+	mux.HandleFunc("PUT /api/devices/{ref}/binding", s.setBinding)
+	mux.HandleFunc("POST /api/devices/{ref}/intensity", s.triggerIntensity)
+	mux.HandleFunc("POST /api/devices/{ref}/pattern", s.triggerPattern)
+	mux.HandleFunc("GET /api/patterns", s.listPatterns)
+	mux.HandleFunc("POST /api/panic", s.stopAll)
+	mux.Handle("GET /api/events", s.events())
+	return s.authorize(mux)
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = auth
+		}
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --- Devices ---
+
+// deviceJSON is how a device is shown to API clients
+type deviceJSON struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	State     string `json:"state"`
+	Reason    string `json:"reason,omitempty"`
+	Connected bool   `json:"connected"`
+	Event     string `json:"event"`
+	Group     string `json:"group,omitempty"`
+}
+
+func toJSON(d devicestore.Device) deviceJSON {
+	return deviceJSON{
+		ID:        d.ID,
+		Name:      d.Name,
+		Enabled:   d.Enabled,
+		State:     d.State.String(),
+		Reason:    d.StateReason,
+		Connected: d.State.Connected(),
+		Event:     d.Event,
+		Group:     d.Group,
+	}
+}
+
+func (s *Server) devices() []deviceJSON {
+	devices := s.store.Snapshot()
+	out := make([]deviceJSON, len(devices))
+	for i, d := range devices {
+		out[i] = toJSON(d)
+	}
+	return out
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.devices())
+}
+
+func (s *Server) getDevice(w http.ResponseWriter, r *http.Request) {
+	if dev, ok := s.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, toJSON(dev))
+	}
+}
+
+func (s *Server) setEnabled(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	dev, ok := s.lookup(w, r)
+	if !ok || !readJSON(w, r, &body) {
+		return
+	}
+	if body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, errors.New("enabled is required"))
+		return
+	}
+	if !*body.Enabled {
+		if ble := s.store.DetachBLE(dev.ID); ble != nil {
+			ble.Disconnect()
+		}
+	}
+	if err := s.store.SetEnabled(dev.ID, *body.Enabled); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.store.ScheduleSave()
+	s.writeDevice(w, dev.ID)
+}
+
+func (s *Server) setBinding(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Event string `json:"event"`
+	}
+	dev, ok := s.lookup(w, r)
+	if !ok || !readJSON(w, r, &body) {
+		return
+	}
+	if err := s.store.SetEvent(dev.ID, body.Event); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.writeDevice(w, dev.ID)
+}
+
+// --- Output ---
+
+func (s *Server) triggerIntensity(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Value      float32 `json:"value"`
+		DurationMs int     `json:"duration_ms"`
+	}
+	dev, ok := s.lookup(w, r)
+	if !ok || !readJSON(w, r, &body) {
+		return
+	}
+	if body.Value < 0 || body.Value > 1 {
+		writeError(w, http.StatusBadRequest, errors.New("value must be between 0 and 1"))
+		return
+	}
+	d := time.Duration(body.DurationMs) * time.Millisecond
+	if d < 0 || d > maxDuration {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("duration_ms must be between 0 and %d", maxDuration.Milliseconds()))
+		return
+	}
+	// patterns outlive the request, so they run on the server context
+	err := s.output.Trigger(s.ctx, dev.ID, body.Value, 1, d, "API")
+	s.writeResult(w, err)
+}
+
+func (s *Server) triggerPattern(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name  string   `json:"name"`
+		Scale *float32 `json:"scale"`
+	}
+	dev, ok := s.lookup(w, r)
+	if !ok || !readJSON(w, r, &body) {
+		return
+	}
+	scale := float32(1)
+	if body.Scale != nil {
+		scale = *body.Scale
+	}
+	if scale < 0 || scale > 1 {
+		writeError(w, http.StatusBadRequest, errors.New("scale must be between 0 and 1"))
+		return
+	}
+	err := s.output.PlayNamed(s.ctx, dev.ID, body.Name, scale, "API pattern "+body.Name)
+	s.writeResult(w, err)
+}
+
+func (s *Server) listPatterns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, outputmanager.PatternNames())
+}
+
+// stopAll mutes output and stops every device; output stays muted until it
+// is unmuted in the app
+func (s *Server) stopAll(w http.ResponseWriter, r *http.Request) {
+	s.output.Panic()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeResult answers an output request with the status that fits err
+func (s *Server) writeResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, outputmanager.ErrUnknownPattern):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, blemanager.ErrNotReady),
+		errors.Is(err, outputmanager.ErrMuted),
+		errors.Is(err, outputmanager.ErrLimited):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusBadGateway, err)
+	}
+}
+
+// --- Helpers ---
+
+// lookup finds the device named by the {ref} path value, an ID or a name.
+// It answers 404 itself when there is none.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (devicestore.Device, bool) {
+	dev, ok := s.store.Lookup(r.PathValue("ref"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no device %q", r.PathValue("ref")))
+	}
+	return dev, ok
+}
+
+func (s *Server) writeDevice(w http.ResponseWriter, id string) {
+	dev, ok := s.store.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no device %q", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, toJSON(dev))
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,208 @@
+package apiserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"touchytails/devicestore"
+	"touchytails/eventbus"
+	"touchytails/outputmanager"
+
+	"golang.org/x/net/websocket"
+)
+
+const testToken = "secret"
+
+// fakeLink accepts every write
+type fakeLink struct{}
+
+func (fakeLink) ConnectDevice(string) error { return nil }
+func (fakeLink) Send(string) error          { return nil }
+func (fakeLink) Ready() bool                { return true }
+func (fakeLink) Battery() (float32, bool)   { return 0, false }
+func (fakeLink) Disconnect()                {}
+
+// newTestServer returns a server with an online device "dev" named Tail
+// and an offline one "off" named Ears
+func newTestServer(t *testing.T) (*Server, *eventbus.Bus) {
+	t.Helper()
+	store := devicestore.New(filepath.Join(t.TempDir(), "devices.json"))
+	store.Add(&devicestore.Device{ID: "dev", Name: "Tail", Enabled: true, State: devicestore.StateOnline})
+	store.SetBLE("dev", fakeLink{})
+	store.Add(&devicestore.Device{ID: "off", Name: "Ears", Enabled: true, State: devicestore.StateOffline})
+	bus := eventbus.New()
+	return New("127.0.0.1:0", testToken, store, outputmanager.New(store, bus), bus), bus
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   int
+	}{
+		{"no token", "", "", http.StatusUnauthorized},
+		{"header", "", "Bearer " + testToken, http.StatusOK},
+		{"query", "?token=" + testToken, "", http.StatusOK},
+		{"wrong header", "", "Bearer nope", http.StatusUnauthorized},
+		{"wrong query", "?token=nope", "", http.StatusUnauthorized},
+		{"header without Bearer", "", testToken, http.StatusUnauthorized},
+		{"wrong header wins over query", "?token=" + testToken, "Bearer nope", http.StatusUnauthorized},
+	}
+	s, _ := newTestServer(t)
+	h := s.Handler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/devices"+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithoutToken(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.token = ""
+	r := httptest.NewRequest("GET", "/api/devices?token=", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d with no token set, want 401", w.Code)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"GET", "/api/devices", "", http.StatusOK},
+		{"GET", "/api/devices/dev", "", http.StatusOK},
+		{"GET", "/api/devices/Tail", "", http.StatusOK},
+		{"GET", "/api/devices/nope", "", http.StatusNotFound},
+		{"PUT", "/api/devices/dev/enabled", `{"enabled":false}`, http.StatusOK},
+		{"PUT", "/api/devices/dev/enabled", `{}`, http.StatusBadRequest},
+		{"PUT", "/api/devices/dev/enabled", `not json`, http.StatusBadRequest},
+		{"PUT", "/api/devices/nope/enabled", `{"enabled":true}`, http.StatusNotFound},
+		{"PUT", "/api/devices/dev/binding", `{"event":"TailTouch"}`, http.StatusOK},
+		{"PUT", "/api/devices/dev/binding", `{"event":"/bad"}`, http.StatusBadRequest},
+		{"POST", "/api/devices/dev/intensity", `{"value":0.5}`, http.StatusNoContent},
+		{"POST", "/api/devices/dev/intensity", `{"value":0.5,"duration_ms":100}`, http.StatusNoContent},
+		{"POST", "/api/devices/dev/intensity", `{"value":2}`, http.StatusBadRequest},
+		{"POST", "/api/devices/dev/intensity", `{"value":0.5,"duration_ms":600000}`, http.StatusBadRequest},
+		{"POST", "/api/devices/off/intensity", `{"value":0.5}`, http.StatusConflict},
+		{"POST", "/api/devices/dev/pattern", `{"name":"nope"}`, http.StatusBadRequest},
+		{"POST", "/api/devices/dev/pattern", `{"name":"pulse","scale":2}`, http.StatusBadRequest},
+		{"GET", "/api/patterns", "", http.StatusOK},
+		{"POST", "/api/panic", "", http.StatusNoContent},
+		{"DELETE", "/api/devices", "", http.StatusMethodNotAllowed},
+		{"GET", "/api/nope", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path+" "+tt.body, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+testToken)
+			w := httptest.NewRecorder()
+			s.Handler().ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestRoutesPanicMutes(t *testing.T) {
+	s, _ := newTestServer(t)
+	r := httptest.NewRequest("POST", "/api/panic", nil)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	s.Handler().ServeHTTP(httptest.NewRecorder(), r)
+	if !s.output.Muted() {
+		t.Error("output not muted after /api/panic")
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s, bus := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.ctx = ctx
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/events?token=" + testToken + "&types=PanicStop"
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+
+	var msg eventJSON
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "devices" || len(msg.Devices) != 2 {
+		t.Fatalf("first message %+v, want the 2 devices", msg)
+	}
+
+	// The stream is subscribed once the device list arrived; types leaves
+	// out the OSC event
+	bus.Publish(eventbus.OSCReceived{Name: "TailTouch", Value: 1})
+	bus.Publish(eventbus.PanicStop{Stopped: 1})
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "PanicStop" {
+		t.Errorf("got %q, want PanicStop", msg.Type)
+	}
+}
+
+func TestEventStreamNeedsToken(t *testing.T) {
+	s, _ := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/events?token=nope"
+	if ws, err := websocket.Dial(url, "", ts.URL); err == nil {
+		ws.Close()
+		t.Error("event stream opened with a wrong token")
+	}
+}
+
+func TestServeFreesPort(t *testing.T) {
+	s, _ := newTestServer(t)
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	addr := s.ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Serve(ctx) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return")
+	}
+	// A restart listens on the same port right away
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("port still taken after Serve returned: %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,123 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"touchytails/eventbus"
+
+	"golang.org/x/net/websocket"
+)
+
+// writeTimeout drops event stream clients that stopped reading
+const writeTimeout = 5 * time.Second
+
+// eventJSON is one message of the event stream
+type eventJSON struct {
+	Type    string       `json:"type"`
+	Time    time.Time    `json:"time"`
+	ID      string       `json:"id,omitempty"`
+	Name    string       `json:"name,omitempty"`
+	State   string       `json:"state,omitempty"`
+	Value   *float32     `json:"value,omitempty"`
+	Text    string       `json:"text,omitempty"`
+	Devices []deviceJSON `json:"devices,omitempty"`
+}
+
+// events streams bus events over a WebSocket. The first message, of type
+// "devices", lists all devices; every later one is a bus event with its
+// type name, e.g. "DeviceStateChanged" or "OSCReceived". The types query
+// parameter, a comma separated list, limits the stream to those types.
+func (s *Server) events() http.Handler {
+	return websocket.Server{
+		// The token already keeps out pages that don't know it, so any
+		// origin, including none, is accepted
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   s.streamEvents,
+	}
+}
+
+func (s *Server) streamEvents(ws *websocket.Conn) {
+	defer ws.Close()
+	var only map[string]bool
+	if types := ws.Request().URL.Query().Get("types"); types != "" {
+		only = map[string]bool{}
+		for _, t := range strings.Split(types, ",") {
+			only[strings.TrimSpace(t)] = true
+		}
+	}
+
+	events, cancel := s.bus.Subscribe(256)
+	defer cancel()
+
+	// The client never sends anything we use; reading notices when it
+	// goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	if !send(ws, eventJSON{Type: "devices", Time: time.Now(), Devices: s.devices()}) {
+		return
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-closed:
+			return
+		case e := <-events:
+			msg := toEventJSON(e)
+			if only != nil && !only[msg.Type] {
+				continue
+			}
+			if !send(ws, msg) {
+				return
+			}
+		}
+	}
+}
+
+func send(ws *websocket.Conn, msg eventJSON) bool {
+	ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return websocket.JSON.Send(ws, msg) == nil
+}
+
+func toEventJSON(e eventbus.Event) eventJSON {
+	msg := eventJSON{
+		Type: strings.TrimPrefix(fmt.Sprintf("%T", e), "eventbus."),
+		Time: time.Now(),
+		Text: e.String(),
+	}
+	switch ev := e.(type) {
+	case eventbus.DeviceConnecting:
+		msg.ID, msg.Name = ev.ID, ev.Name
+	case eventbus.DeviceConnected:
+		msg.ID, msg.Name = ev.ID, ev.Name
+	case eventbus.DeviceDisconnected:
+		msg.ID, msg.Name = ev.ID, ev.Name
+	case eventbus.DeviceStateChanged:
+		msg.ID, msg.Name, msg.State = ev.ID, ev.Name, ev.To
+	case eventbus.TransitionRejected:
+		msg.ID, msg.Name, msg.State = ev.ID, ev.Name, ev.To
+	case eventbus.ConnectFailed:
+		msg.ID, msg.Name = ev.ID, ev.Name
+	case eventbus.SendFailed:
+		msg.ID, msg.Name = ev.ID, ev.Name
+	case eventbus.OutputSent:
+		msg.ID, msg.Name, msg.Value = ev.ID, ev.Name, &ev.Value
+	case eventbus.LimitChanged:
+		msg.ID, msg.Name = ev.ID, ev.Name
+	case eventbus.BatteryChanged:
+		msg.ID, msg.Name, msg.Value = ev.ID, ev.Name, &ev.Level
+	case eventbus.OSCReceived:
+		msg.Name, msg.Value = ev.Name, &ev.Value
+	case eventbus.ScanResult:
+		msg.ID, msg.Name = ev.Address, ev.Name
+	}
+	return msg
+}
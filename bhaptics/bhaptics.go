@@ -0,0 +1,338 @@
+// Package bhaptics lets games and mods made for bHaptics gear drive
+// TouchyTails devices. It speaks the WebSocket protocol of the bHaptics
+// Player, so SDKs that would connect to the Player connect to the bridge
+// instead, and plays what they send on the devices mapped to each
+// bHaptics position.
+package bhaptics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+	"touchytails/devicestore"
+	"touchytails/outputmanager"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// DefaultPort is the port of the bHaptics Player, which SDKs connect
+	// to. The Player itself must not run at the same time.
+	DefaultPort = 15881
+	// statusInterval is how often connected SDKs get a fresh status
+	statusInterval = time.Second
+	// frameHold is how long a frame without a duration plays
+	frameHold    = 100 * time.Millisecond
+	writeTimeout = 5 * time.Second
+)
+
+// Bridge is the bHaptics Player stand-in. SDKs send no credentials, so
+// it should only listen on a loopback address.
+type Bridge struct {
+	Addr   string
+	store  *devicestore.DeviceStore
+	output *outputmanager.OutputManager
+	ctx    context.Context // ends patterns started by the bridge
+	ln     net.Listener
+
+	mu      sync.Mutex
+	clips   map[string]clip     // registered projects by key
+	playing map[string]playback // keys still playing
+}
+
+// playback is what a submitted key plays until end. With an altKey it is
+// another key's clip.
+type playback struct {
+	clip clip
+	end  time.Time
+}
+
+// New creates a Bridge for addr
+func New(addr string, store *devicestore.DeviceStore, output *outputmanager.OutputManager) *Bridge {
+	return &Bridge{
+		Addr:    addr,
+		store:   store,
+		output:  output,
+		ctx:     context.Background(),
+		clips:   map[string]clip{},
+		playing: map[string]playback{},
+	}
+}
+
+// Listen binds the TCP port
+func (b *Bridge) Listen() error {
+	ln, err := net.Listen("tcp", b.Addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", b.Addr, err)
+	}
+	b.ln = ln
+	return nil
+}
+
+// Serve accepts SDK connections on the port opened by Listen until ctx is
+// cancelled, then returns nil. onEvent gets connects and disconnects.
+func (b *Bridge) Serve(ctx context.Context, onEvent func(msg string)) error {
+	if b.ln == nil {
+		return errors.New("bhaptics: Serve called before Listen")
+	}
+	b.ctx = ctx
+	srv := &http.Server{
+		// SDK versions use different paths, e.g. /v2/feedbacks
+		Handler: websocket.Server{
+			Handshake: checkOrigin,
+			Handler:   func(ws *websocket.Conn) { b.serveConn(ws, onEvent) },
+		},
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(b.ln); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// checkOrigin keeps web pages other than local ones from driving the
+// devices. Native SDKs send no origin; browser SDKs run on local pages.
+func checkOrigin(_ *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" || localOrigin(origin) {
+		return nil
+	}
+	return fmt.Errorf("bhaptics: origin %s not allowed", origin)
+}
+
+// localOrigin reports whether origin is a file or a loopback host. The
+// opaque origin "null" is refused, since sandboxed frames of any site
+// send it too.
+func localOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "file":
+		return true
+	case "http", "https":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	return false
+}
+
+func (b *Bridge) serveConn(ws *websocket.Conn, onEvent func(msg string)) {
+	defer ws.Close()
+	app := ws.Request().URL.Query().Get("app_id")
+	if app == "" {
+		app = ws.Request().URL.Path
+	}
+	onEvent("bHaptics app connected: " + app)
+	defer onEvent("bHaptics app disconnected: " + app)
+
+	// Answer every request with a status, like the Player does
+	received := make(chan struct{}, 1)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var req request
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				var syntax *json.SyntaxError
+				var badType *json.UnmarshalTypeError
+				if errors.As(err, &syntax) || errors.As(err, &badType) {
+					continue
+				}
+				return
+			}
+			b.handle(req)
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if websocket.JSON.Send(ws, b.status()) != nil {
+			return
+		}
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-closed:
+			return
+		case <-received:
+		case <-ticker.C:
+		}
+	}
+}
+
+// handle registers the projects of a request and plays its submits
+func (b *Bridge) handle(req request) {
+	for _, r := range req.Register {
+		c, err := compile(r.Project)
+		if err != nil || r.Key == "" {
+			continue
+		}
+		b.mu.Lock()
+		b.clips[r.Key] = c
+		b.mu.Unlock()
+	}
+	for _, s := range req.Submit {
+		switch s.Type {
+		case "frame":
+			if s.Frame != nil {
+				b.playFrame(s.Frame)
+			}
+		case "key":
+			b.playKey(s)
+		case "turnOff":
+			b.turnOff(s.Key)
+		case "turnOffAll":
+			b.turnOffAll()
+		}
+	}
+}
+
+// playFrame holds the strongest motor of a frame on the position's
+// devices; an all-zero frame switches them off
+func (b *Bridge) playFrame(f *frame) {
+	hold := time.Duration(f.DurationMillis) * time.Millisecond
+	if hold <= 0 {
+		hold = frameHold
+	}
+	value := f.value()
+	for _, pos := range expand(f.Position) {
+		for _, t := range b.store.BHapticsTargets(pos) {
+			b.output.Trigger(b.ctx, t.ID, value, t.Scale, hold, "bHaptics "+pos)
+		}
+	}
+}
+
+// playKey plays a registered project on every mapped position it uses
+func (b *Bridge) playKey(s submit) {
+	key := s.Key
+	if s.Parameters.AltKey != "" {
+		key = s.Parameters.AltKey
+	}
+	intensity, duration := float32(1), float32(1)
+	if opt := s.Parameters.ScaleOption; opt != nil {
+		if opt.Intensity > 0 {
+			intensity = opt.Intensity
+		}
+		if opt.Duration > 0 {
+			duration = opt.Duration
+		}
+	}
+
+	b.mu.Lock()
+	c, ok := b.clips[key]
+	if ok {
+		end := time.Duration(float32(c.length()) * duration)
+		b.playing[s.Key] = playback{c, time.Now().Add(end)}
+	}
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+	for pos := range c {
+		p := c.pattern(pos, intensity, duration)
+		for _, t := range b.store.BHapticsTargets(pos) {
+			b.output.Play(b.ctx, t.ID, p, t.Scale, "bHaptics "+s.Key)
+		}
+	}
+}
+
+// turnOff stops the positions a key plays on
+func (b *Bridge) turnOff(key string) {
+	b.mu.Lock()
+	c := b.clips[key]
+	if p, ok := b.playing[key]; ok {
+		c = p.clip
+	}
+	delete(b.playing, key)
+	b.mu.Unlock()
+	for pos := range c {
+		b.stop(pos)
+	}
+}
+
+func (b *Bridge) turnOffAll() {
+	b.mu.Lock()
+	clear(b.playing)
+	b.mu.Unlock()
+	for _, pos := range Positions {
+		b.stop(pos)
+	}
+}
+
+func (b *Bridge) stop(position string) {
+	for _, t := range b.store.BHapticsTargets(position) {
+		b.output.Trigger(b.ctx, t.ID, 0, t.Scale, 0, "bHaptics "+position)
+	}
+}
+
+// status reports registered and playing keys and the positions that have
+// a connected device, under every name SDKs may ask for
+func (b *Bridge) status() status {
+	// SDKs expect lists, not null
+	st := status{
+		RegisteredKeys:     []string{},
+		ActiveKeys:         []string{},
+		ConnectedPositions: []string{},
+		Status:             map[string][]int{},
+	}
+	b.mu.Lock()
+	now := time.Now()
+	for key := range b.clips {
+		st.RegisteredKeys = append(st.RegisteredKeys, key)
+	}
+	for key, p := range b.playing {
+		if now.Before(p.end) {
+			st.ActiveKeys = append(st.ActiveKeys, key)
+		} else {
+			delete(b.playing, key)
+		}
+	}
+	b.mu.Unlock()
+
+	connected := map[string]bool{}
+	for _, pos := range Positions {
+		n := len(b.store.BHapticsTargets(pos))
+		if n == 0 {
+			continue
+		}
+		st.ConnectedDeviceCount += n
+		connected[pos] = true
+		for alias, ps := range aliases {
+			for _, p := range ps {
+				if p == pos {
+					connected[alias] = true
+				}
+			}
+		}
+	}
+	for pos := range connected {
+		st.ConnectedPositions = append(st.ConnectedPositions, pos)
+	}
+	sort.Strings(st.RegisteredKeys)
+	sort.Strings(st.ActiveKeys)
+	sort.Strings(st.ConnectedPositions)
+	return st
+}
@@ -0,0 +1,224 @@
+package bhaptics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"touchytails/blemanager"
+	"touchytails/devicestore"
+	"touchytails/eventbus"
+	"touchytails/outputmanager"
+)
+
+func newBridge(t *testing.T) *Bridge {
+	store := devicestore.New(filepath.Join(t.TempDir(), "devices.json"))
+	return New("127.0.0.1:0", store, outputmanager.New(store, eventbus.New()))
+}
+
+// tact returns a one-track project that plays intensity on position from
+// start for offset milliseconds
+func tact(position string, start, offset int, intensity float32) string {
+	return fmt.Sprintf(`{"Tracks":[{"Effects":[{"StartTime":%d,"OffsetTime":%d,"Modes":{%q:
+		{"Mode":"DOT_MODE","DotMode":{"Feedback":[{"PointList":[{"Intensity":%v}]}]}}}}]}]}`,
+		start, offset, position, intensity)
+}
+
+// send hands an SDK message to the bridge
+func send(t *testing.T, b *Bridge, msg string) {
+	t.Helper()
+	var req request
+	if err := json.Unmarshal([]byte(msg), &req); err != nil {
+		t.Fatal(err)
+	}
+	b.handle(req)
+}
+
+func TestServeFreesPort(t *testing.T) {
+	b := newBridge(t)
+	if err := b.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	addr := b.ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Serve(ctx, func(string) {}) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return")
+	}
+	// A restart listens on the same port right away
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("port still taken after Serve returned: %v", err)
+	}
+	ln.Close()
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true}, // native SDKs
+		{"http://localhost:8080", true},
+		{"https://localhost", true},
+		{"http://127.0.0.1:5500", true},
+		{"http://[::1]:3000", true},
+		{"file://", true},
+		{"null", false},
+		{"https://example.com", false},
+		{"http://localhost.example.com", false},
+		{"http://192.168.1.10", false},
+		{"ws://localhost", false},
+		{"::not an origin", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v2/feedbacks", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if err := checkOrigin(nil, req); (err == nil) != tt.ok {
+			t.Errorf("checkOrigin(%q) = %v, want allowed %v", tt.origin, err, tt.ok)
+		}
+	}
+}
+
+type fakeLink struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (l *fakeLink) ConnectDevice(string) error { return nil }
+func (l *fakeLink) Ready() bool                { return true }
+func (l *fakeLink) Battery() (float32, bool)   { return 0, false }
+func (l *fakeLink) Disconnect()                {}
+
+func (l *fakeLink) Send(data string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sent = append(l.sent, data)
+	return nil
+}
+
+func (l *fakeLink) last() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.sent) == 0 {
+		return ""
+	}
+	return l.sent[len(l.sent)-1]
+}
+
+// addDevice maps an online device on a fake link to position
+func addDevice(t *testing.T, b *Bridge, id, position string) *fakeLink {
+	t.Helper()
+	link := &fakeLink{}
+	b.store.Add(&devicestore.Device{ID: id, Name: id, Enabled: true, State: devicestore.StateOnline})
+	b.store.SetBLE(id, link)
+	if err := b.store.SetBHaptics(id, position); err != nil {
+		t.Fatal(err)
+	}
+	return link
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + what)
+		}
+	}
+}
+
+func TestAltKeyTurnOff(t *testing.T) {
+	b := newBridge(t)
+	head := addDevice(t, b, "head", "Head")
+	vest := addDevice(t, b, "vest", "VestFront")
+	send(t, b, `{"Register":[{"Key":"head","Project":`+tact("Head", 0, 5000, 1)+`},
+		{"Key":"vest","Project":`+tact("Vest", 0, 5000, 1)+`}]}`)
+
+	// Key head plays the vest clip
+	send(t, b, `{"Submit":[{"Type":"key","Key":"head","Parameters":{"altKey":"vest"}}]}`)
+	waitFor(t, "the vest to play", func() bool { return vest.last() == "1.00" })
+	if st := b.status(); fmt.Sprint(st.ActiveKeys) != "[head]" {
+		t.Errorf("active keys %v, want the submitted key", st.ActiveKeys)
+	}
+
+	// Turning it off stops the vest, which is what plays
+	send(t, b, `{"Submit":[{"Type":"turnOff","Key":"head"}]}`)
+	if got := vest.last(); got != blemanager.StopCommand {
+		t.Errorf("vest device last got %q, want the stop command", got)
+	}
+	if st := b.status(); len(st.ActiveKeys) != 0 {
+		t.Errorf("active keys %v after turnOff", st.ActiveKeys)
+	}
+	if got := head.last(); got != "" {
+		t.Errorf("head device got %q, want nothing", got)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, b *Bridge)
+		want      status
+		remaining int // entries left in playing
+	}{
+		{
+			name:  "nothing",
+			setup: func(*testing.T, *Bridge) {},
+			want:  status{RegisteredKeys: []string{}, ActiveKeys: []string{}, ConnectedPositions: []string{}, Status: map[string][]int{}},
+		},
+		{
+			name: "keys and devices",
+			setup: func(t *testing.T, b *Bridge) {
+				addDevice(t, b, "front", "VestFront")
+				addDevice(t, b, "arm", "ForearmL")
+				addDevice(t, b, "arm2", "ForearmL")
+				b.store.Add(&devicestore.Device{ID: "off", Name: "off", Enabled: true})
+				b.store.SetBHaptics("off", "Head")
+				send(t, b, `{"Register":[{"Key":"hit","Project":`+tact("Head", 0, 100, 1)+`},
+					{"Key":"pet","Project":`+tact("Head", 0, 100, 1)+`}]}`)
+				now := time.Now()
+				b.playing["pet"] = playback{end: now.Add(time.Minute)}
+				b.playing["hit"] = playback{end: now.Add(-time.Second)}
+			},
+			want: status{
+				RegisteredKeys:       []string{"hit", "pet"},
+				ActiveKeys:           []string{"pet"},
+				ConnectedDeviceCount: 3,
+				// the vest and left arm aliases count as connected too
+				ConnectedPositions: []string{"ForearmL", "Left", "Vest", "VestFront"},
+				Status:             map[string][]int{},
+			},
+			remaining: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBridge(t)
+			tt.setup(t, b)
+			if got := b.status(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			// Keys that ended are dropped
+			if len(b.playing) != tt.remaining {
+				t.Errorf("%d keys playing, want %d", len(b.playing), tt.remaining)
+			}
+		})
+	}
+}
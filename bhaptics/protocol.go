@@ -0,0 +1,222 @@
+package bhaptics
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"touchytails/outputmanager"
+)
+
+// Positions are the bHaptics positions a device can be mapped to
+var Positions = []string{
+	"VestFront", "VestBack", "Head",
+	"ForearmL", "ForearmR", "HandL", "HandR",
+	"GloveL", "GloveR", "FootL", "FootR",
+}
+
+// aliases are other names SDKs and tact files use for positions
+var aliases = map[string][]string{
+	"Vest":       {"VestFront", "VestBack"},
+	"Left":       {"ForearmL"},
+	"Right":      {"ForearmR"},
+	"GloveLeft":  {"GloveL"},
+	"GloveRight": {"GloveR"},
+}
+
+// expand returns the positions a name stands for
+func expand(name string) []string {
+	if ps, ok := aliases[name]; ok {
+		return ps
+	}
+	for _, p := range Positions {
+		if strings.EqualFold(p, name) {
+			return []string{p}
+		}
+	}
+	return nil
+}
+
+// --- messages ---
+
+// request is what an SDK sends: tact projects to register under a key and
+// haptics to play
+type request struct {
+	Register []struct {
+		Key     string
+		Project json.RawMessage
+	}
+	Submit []submit
+}
+
+// submit is one playback request. Type "frame" plays Frame directly, "key"
+// plays a registered project, "turnOff" stops one key and "turnOffAll"
+// stops everything.
+type submit struct {
+	Type       string
+	Key        string
+	Frame      *frame
+	Parameters struct {
+		AltKey      string `json:"altKey"`
+		ScaleOption *struct {
+			Intensity float32 `json:"intensity"`
+			Duration  float32 `json:"duration"`
+		} `json:"scaleOption"`
+	}
+}
+
+// frame sets the motors of one position for DurationMillis. Intensities
+// are 0..100.
+type frame struct {
+	Position   string
+	DotPoints  []struct{ Index, Intensity int }
+	PathPoints []struct {
+		X, Y      float32
+		Intensity int
+	}
+	DurationMillis int
+}
+
+// value returns the strongest motor of the frame as 0..1
+func (f *frame) value() float32 {
+	strongest := 0
+	for _, p := range f.DotPoints {
+		strongest = max(strongest, p.Intensity)
+	}
+	for _, p := range f.PathPoints {
+		strongest = max(strongest, p.Intensity)
+	}
+	return max(0, min(1, float32(strongest)/100))
+}
+
+// status is what the bridge reports back, the way the bHaptics player
+// does. SDKs check ConnectedPositions before they play anything.
+type status struct {
+	RegisteredKeys       []string
+	ActiveKeys           []string
+	ConnectedDeviceCount int
+	ConnectedPositions   []string
+	Status               map[string][]int
+}
+
+// --- tact projects ---
+
+// project is the part of a .tact project the bridge plays. Motor layouts
+// are left out: a device plays the strongest motor of its position.
+type project struct {
+	Tracks []struct {
+		Enable  *bool
+		Effects []struct {
+			StartTime  int
+			OffsetTime int
+			Modes      map[string]struct {
+				Mode     string
+				DotMode  feedbacks
+				PathMode feedbacks
+			}
+		}
+	}
+}
+
+type feedbacks struct {
+	Feedback []struct {
+		PointList []struct{ Intensity float32 }
+	}
+}
+
+func (f feedbacks) strongest() float32 {
+	var v float32
+	for _, fb := range f.Feedback {
+		for _, p := range fb.PointList {
+			v = max(v, p.Intensity)
+		}
+	}
+	return v
+}
+
+// segment holds value from start to end
+type segment struct {
+	start, end time.Duration
+	value      float32
+}
+
+// clip is a compiled project: what each position plays, sorted by start
+type clip map[string][]segment
+
+// compile turns a registered project into a clip. Some SDKs send the
+// project as a JSON string instead of an object.
+func compile(raw json.RawMessage) (clip, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		raw = json.RawMessage(text)
+	}
+	var p project
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	c := clip{}
+	for _, t := range p.Tracks {
+		if t.Enable != nil && !*t.Enable {
+			continue
+		}
+		for _, e := range t.Effects {
+			start := time.Duration(e.StartTime) * time.Millisecond
+			end := start + time.Duration(e.OffsetTime)*time.Millisecond
+			for name, m := range e.Modes {
+				var v float32
+				switch m.Mode {
+				case "DOT_MODE":
+					v = m.DotMode.strongest()
+				case "PATH_MODE":
+					v = m.PathMode.strongest()
+				default:
+					v = max(m.DotMode.strongest(), m.PathMode.strongest())
+				}
+				if v <= 0 || end <= start {
+					continue
+				}
+				for _, pos := range expand(name) {
+					c[pos] = append(c[pos], segment{start, end, min(1, v)})
+				}
+			}
+		}
+	}
+	for _, segs := range c {
+		sort.Slice(segs, func(i, j int) bool { return segs[i].start < segs[j].start })
+	}
+	return c, nil
+}
+
+// length returns when the last segment ends
+func (c clip) length() time.Duration {
+	var d time.Duration
+	for _, segs := range c {
+		for _, s := range segs {
+			d = max(d, s.end)
+		}
+	}
+	return d
+}
+
+// pattern returns what a position plays, with values scaled by intensity
+// and times by duration. Overlapping effects are cut where the next one
+// starts later than the previous ends.
+func (c clip) pattern(position string, intensity, duration float32) outputmanager.Pattern {
+	stretch := func(d time.Duration) time.Duration { return time.Duration(float32(d) * duration) }
+	var p outputmanager.Pattern
+	var at time.Duration
+	for _, s := range c[position] {
+		start, end := stretch(s.start), stretch(s.end)
+		if end <= at {
+			continue
+		}
+		if start > at {
+			p = append(p, outputmanager.Step{Value: 0, Duration: start - at})
+		} else {
+			start = at
+		}
+		p = append(p, outputmanager.Step{Value: min(1, s.value*intensity), Duration: end - start})
+		at = end
+	}
+	return p
+}
@@ -0,0 +1,166 @@
+package bhaptics
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+	"touchytails/outputmanager"
+)
+
+const ms = time.Millisecond
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"Head", []string{"Head"}},
+		{"head", []string{"Head"}},
+		{"VESTBACK", []string{"VestBack"}},
+		{"Vest", []string{"VestFront", "VestBack"}},
+		{"Left", []string{"ForearmL"}},
+		{"Right", []string{"ForearmR"}},
+		{"GloveLeft", []string{"GloveL"}},
+		{"GloveRight", []string{"GloveR"}},
+		{"Tail", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := expand(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expand(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFrameValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		want  float32
+	}{
+		{"empty", `{}`, 0},
+		{"all off", `{"DotPoints":[{"Index":0,"Intensity":0}]}`, 0},
+		{"strongest dot", `{"DotPoints":[{"Index":0,"Intensity":20},{"Index":3,"Intensity":60}]}`, 0.6},
+		{"strongest path point", `{"PathPoints":[{"X":0.5,"Y":0.5,"Intensity":40}]}`, 0.4},
+		{"dots and path", `{"DotPoints":[{"Intensity":30}],"PathPoints":[{"Intensity":70}]}`, 0.7},
+		{"above 100", `{"DotPoints":[{"Intensity":150}]}`, 1},
+		{"negative", `{"DotPoints":[{"Intensity":-20}]}`, 0},
+	}
+	for _, tt := range tests {
+		var f frame
+		if err := json.Unmarshal([]byte(tt.frame), &f); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.value(); got != tt.want {
+			t.Errorf("%s: value() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	asString, _ := json.Marshal(tact("Head", 0, 100, 0.5))
+	// modes plays dot and path intensities under mode on the head
+	modes := func(mode string) string {
+		return `{"Tracks":[{"Effects":[{"StartTime":0,"OffsetTime":100,"Modes":{"Head":{"Mode":"` + mode + `",
+			"DotMode":{"Feedback":[{"PointList":[{"Intensity":0.2}]}]},
+			"PathMode":{"Feedback":[{"PointList":[{"Intensity":0.7}]}]}}}}]}]}`
+	}
+	tests := []struct {
+		name    string
+		project string
+		want    clip
+		wantErr bool
+	}{
+		{
+			name:    "object",
+			project: tact("Head", 0, 100, 0.5),
+			want:    clip{"Head": {{0, 100 * ms, 0.5}}},
+		},
+		{
+			name:    "string",
+			project: string(asString),
+			want:    clip{"Head": {{0, 100 * ms, 0.5}}},
+		},
+		{
+			name:    "alias",
+			project: tact("Vest", 50, 100, 0.5),
+			want:    clip{"VestFront": {{50 * ms, 150 * ms, 0.5}}, "VestBack": {{50 * ms, 150 * ms, 0.5}}},
+		},
+		{
+			name: "disabled track",
+			project: `{"Tracks":[{"Enable":false,"Effects":[{"StartTime":0,"OffsetTime":100,"Modes":{"Head":
+				{"Mode":"DOT_MODE","DotMode":{"Feedback":[{"PointList":[{"Intensity":1}]}]}}}}]}]}`,
+			want: clip{},
+		},
+		{
+			name: "enabled track",
+			project: `{"Tracks":[{"Enable":true,"Effects":[{"StartTime":0,"OffsetTime":100,"Modes":{"Head":
+				{"Mode":"DOT_MODE","DotMode":{"Feedback":[{"PointList":[{"Intensity":1}]}]}}}}]}]}`,
+			want: clip{"Head": {{0, 100 * ms, 1}}},
+		},
+		{name: "dot mode", project: modes("DOT_MODE"), want: clip{"Head": {{0, 100 * ms, 0.2}}}},
+		{name: "path mode", project: modes("PATH_MODE"), want: clip{"Head": {{0, 100 * ms, 0.7}}}},
+		{name: "no mode", project: modes(""), want: clip{"Head": {{0, 100 * ms, 0.7}}}},
+		{name: "intensity capped", project: tact("Head", 0, 100, 2), want: clip{"Head": {{0, 100 * ms, 1}}}},
+		{name: "silent effect", project: tact("Head", 0, 100, 0), want: clip{}},
+		{name: "empty effect", project: tact("Head", 100, 0, 1), want: clip{}},
+		{name: "unknown position", project: tact("Tail", 0, 100, 1), want: clip{}},
+		{
+			name: "sorted by start",
+			project: `{"Tracks":[
+				{"Effects":[{"StartTime":300,"OffsetTime":100,"Modes":{"Head":{"Mode":"DOT_MODE","DotMode":{"Feedback":[{"PointList":[{"Intensity":0.3}]}]}}}}]},
+				{"Effects":[{"StartTime":0,"OffsetTime":100,"Modes":{"Head":{"Mode":"DOT_MODE","DotMode":{"Feedback":[{"PointList":[{"Intensity":0.1}]}]}}}}]}]}`,
+			want: clip{"Head": {{0, 100 * ms, 0.1}, {300 * ms, 400 * ms, 0.3}}},
+		},
+		{name: "not a project", project: `[1,2]`, wantErr: true},
+		{name: "string that is not a project", project: `"Tracks"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compile(json.RawMessage(tt.project))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipPattern(t *testing.T) {
+	c := clip{
+		"Head":      {{0, 100 * ms, 0.5}},
+		"VestFront": {{100 * ms, 200 * ms, 0.5}, {300 * ms, 400 * ms, 0.8}},
+		// the second is inside the first, the third starts before it ends
+		"ForearmL": {{0, 300 * ms, 0.4}, {100 * ms, 200 * ms, 1}, {200 * ms, 500 * ms, 0.6}},
+	}
+	type p = outputmanager.Pattern
+	step := func(value float32, d time.Duration) outputmanager.Step {
+		return outputmanager.Step{Value: value, Duration: d}
+	}
+	tests := []struct {
+		name                string
+		position            string
+		intensity, duration float32
+		want                p
+	}{
+		{"plain", "Head", 1, 1, p{step(0.5, 100*ms)}},
+		{"gaps", "VestFront", 1, 1, p{step(0, 100*ms), step(0.5, 100*ms), step(0, 100*ms), step(0.8, 100*ms)}},
+		{"overlaps", "ForearmL", 1, 1, p{step(0.4, 300*ms), step(0.6, 200*ms)}},
+		{"longer", "VestFront", 1, 2, p{step(0, 200*ms), step(0.5, 200*ms), step(0, 200*ms), step(0.8, 200*ms)}},
+		{"shorter", "Head", 1, 0.5, p{step(0.5, 50*ms)}},
+		{"weaker", "Head", 0.5, 1, p{step(0.25, 100*ms)}},
+		{"stronger capped", "VestFront", 2, 1, p{step(0, 100*ms), step(1, 100*ms), step(0, 100*ms), step(1, 100*ms)}},
+		{"unused position", "HandL", 1, 1, nil},
+	}
+	for _, tt := range tests {
+		if got := c.pattern(tt.position, tt.intensity, tt.duration); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := c.length(); got != 500*ms {
+		t.Errorf("length %v, want 500ms", got)
+	}
+}
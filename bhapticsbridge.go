@@ -0,0 +1,131 @@
+// bhapticsbridge.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"touchytails/bhaptics"
+	"touchytails/devicestore"
+	"touchytails/logstore"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- bHaptics bridge ---
+
+// notMapped is the position choice for devices the bridge leaves alone
+const notMapped = "Not mapped"
+
+var (
+	bhapticsMu   sync.Mutex
+	bhapticsStop func() // stops the running bridge and waits until its port is free, nil if off
+)
+
+// bhapticsPort returns the configured bridge port
+func bhapticsPort() int {
+	if port := store.Settings().BHapticsPort; port > 0 {
+		return port
+	}
+	return bhaptics.DefaultPort
+}
+
+// startBHaptics (re)starts the bHaptics bridge as the settings say,
+// stopping the bridge already running
+func startBHaptics(console *Console) {
+	bhapticsMu.Lock()
+	defer bhapticsMu.Unlock()
+	if bhapticsStop != nil {
+		bhapticsStop()
+		bhapticsStop = nil
+	}
+	if !store.Settings().BHapticsEnabled {
+		return
+	}
+
+	addr := fmt.Sprintf("%s:%d", apiHost, bhapticsPort())
+	bridge := bhaptics.New(addr, store, output)
+	if err := bridge.Listen(); err != nil {
+		console.Log(logstore.LevelError, "", "bhaptics", "bHaptics bridge failed, is the bHaptics Player running? "+err.Error())
+		return
+	}
+	ctx, cancel := context.WithCancel(appCtx)
+	done := make(chan struct{})
+	// As with the API, a restart on the same port waits for Serve to close it
+	bhapticsStop = func() {
+		cancel()
+		<-done
+	}
+	console.Log(logstore.LevelInfo, "", "bhaptics", "bHaptics bridge listening on ws://"+addr)
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		defer close(done)
+		onEvent := func(msg string) { console.Log(logstore.LevelInfo, "", "bhaptics", msg) }
+		if err := bridge.Serve(ctx, onEvent); err != nil {
+			console.Log(logstore.LevelError, "", "bhaptics", "bHaptics bridge stopped: "+err.Error())
+		}
+	}()
+}
+
+// showBHapticsSettings lets the user switch the bridge on and off, pick
+// its port and choose the bHaptics position each device plays
+func showBHapticsSettings(console *Console) {
+	wasEnabled := store.Settings().BHapticsEnabled
+	enabled := widget.NewCheck("Enable the bHaptics bridge", nil)
+	enabled.SetChecked(wasEnabled)
+
+	port := widget.NewEntry()
+	port.SetText(strconv.Itoa(bhapticsPort()))
+	port.Validator = func(text string) error {
+		_, err := parsePort(text)
+		return err
+	}
+
+	help := widget.NewLabel("Games made for bHaptics gear play on the devices below.\n" +
+		"Close the bHaptics Player first, the bridge takes its place.")
+	items := []*widget.FormItem{
+		widget.NewFormItem("", enabled),
+		widget.NewFormItem("Port", port),
+		widget.NewFormItem("", help),
+	}
+
+	choices := append([]string{notMapped}, bhaptics.Positions...)
+	devices := store.Snapshot()
+	positions := make([]*widget.Select, len(devices))
+	for i, d := range devices {
+		positions[i] = widget.NewSelect(choices, nil)
+		positions[i].SetSelected(notMapped)
+		if d.BHaptics != "" {
+			positions[i].SetSelected(d.BHaptics)
+		}
+		items = append(items, widget.NewFormItem(d.Name, positions[i]))
+	}
+
+	dialog.ShowForm("bHaptics bridge", "Save", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		for i, d := range devices {
+			pos := positions[i].Selected
+			if pos == notMapped {
+				pos = ""
+			}
+			if pos != d.BHaptics {
+				store.SetBHaptics(d.ID, pos)
+			}
+		}
+		p, _ := parsePort(port.Text)
+		store.UpdateSettings(func(st *devicestore.Settings) {
+			st.BHapticsEnabled = enabled.Checked
+			st.BHapticsPort = p
+		})
+		if wasEnabled && !enabled.Checked {
+			console.Log(logstore.LevelInfo, "", "bhaptics", "bHaptics bridge off")
+		}
+		startBHaptics(console)
+	}, mainWindow)
+}
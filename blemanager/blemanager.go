@@ -2,8 +2,8 @@ package blemanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
@@ -12,6 +12,19 @@ import (
 
 var adapter = bluetooth.DefaultAdapter
 
+// StopCommand is written to a device to switch its output off
+const StopCommand = "0"
+
+var (
+	ErrNotReady    = errors.New("device not ready")
+	ErrSendTimeout = errors.New("send timeout")
+
+	// Returned by ConnectDevice when the device does not expose the
+	// TouchyTails service, i.e. it runs other or outdated firmware.
+	ErrServiceNotFound        = errors.New("service not found")
+	ErrCharacteristicNotFound = errors.New("characteristic not found")
+)
+
 const (
 	serviceUUIDStr        = "0000ab00-0000-1000-8000-00805f9b34fb"
 	characteristicUUIDStr = "0000ab01-0000-1000-8000-00805f9b34fb"
@@ -19,10 +32,11 @@ const (
 
 // BLEManager encapsulates the BLE device connection
 type BLEManager struct {
-	device bluetooth.Device
-	char   *bluetooth.DeviceCharacteristic
-	ready  bool
-	mu     sync.Mutex
+	device  bluetooth.Device
+	char    *bluetooth.DeviceCharacteristic
+	battery *bluetooth.DeviceCharacteristic // nil without a battery service
+	ready   bool
+	mu      sync.Mutex
 }
 
 // New creates a new BLEManager and enables the adapter
@@ -37,7 +51,7 @@ func (b *BLEManager) ScanDevice(
 	deviceName string,
 	timeout time.Duration,
 	onEvent func(msg string), // <-- new callback
-	onFound func(addr string),
+	onResult func(name, addr string, target bool),
 ) {
 	go func() {
 		onEvent("Starting scan for " + deviceName + "...")
@@ -54,11 +68,7 @@ func (b *BLEManager) ScanDevice(
 
 		// This blocks until StopScan is called
 		err := adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
-			onEvent("Found: " + result.LocalName() + " [" + result.Address.String() + "]")
-			if result.LocalName() == deviceName {
-				onEvent("Found target: " + result.LocalName() + " [" + result.Address.String() + "]")
-				onFound(result.Address.String())
-			}
+			onResult(result.LocalName(), result.Address.String(), result.LocalName() == deviceName)
 		})
 		if err != nil {
 			onEvent("Failed to start scan:" + err.Error())
@@ -87,15 +97,17 @@ func (b *BLEManager) ConnectDevice(addr string) error {
 		return fmt.Errorf("failed to discover services: %w", err)
 	}
 
-	var targetService *bluetooth.DeviceService
+	var targetService, batteryService *bluetooth.DeviceService
 	for _, s := range services {
-		if s.UUID().String() == serviceUUIDStr {
+		switch {
+		case s.UUID().String() == serviceUUIDStr:
 			targetService = &s
-			break
+		case s.UUID() == bluetooth.ServiceUUIDBattery:
+			batteryService = &s
 		}
 	}
 	if targetService == nil {
-		return fmt.Errorf("service not found")
+		return ErrServiceNotFound
 	}
 
 	chars, err := targetService.DiscoverCharacteristics(nil)
@@ -111,12 +123,23 @@ func (b *BLEManager) ConnectDevice(addr string) error {
 		}
 	}
 	if targetChar == nil {
-		return fmt.Errorf("characteristic not found")
+		return ErrCharacteristicNotFound
+	}
+
+	// The battery service is optional, devices without one just don't
+	// report a level
+	var batteryChar *bluetooth.DeviceCharacteristic
+	if batteryService != nil {
+		chars, err := batteryService.DiscoverCharacteristics([]bluetooth.UUID{bluetooth.CharacteristicUUIDBatteryLevel})
+		if err == nil && len(chars) > 0 {
+			batteryChar = &chars[0]
+		}
 	}
 
 	b.mu.Lock()
 	b.device = device
 	b.char = targetChar
+	b.battery = batteryChar
 	b.ready = true
 	b.mu.Unlock()
 
@@ -124,13 +147,14 @@ func (b *BLEManager) ConnectDevice(addr string) error {
 	return nil
 }
 
-func (b *BLEManager) Send(data string) {
+// Send writes data to the device. A failed or timed out write marks the
+// device as not ready so the runtime manager reconnects it.
+func (b *BLEManager) Send(data string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	if !b.ready || b.char == nil {
-		log.Println("BLE device not ready, skipping send:", data)
-		return
+		return ErrNotReady
 	}
 
 	done := make(chan error, 1)
@@ -144,14 +168,46 @@ func (b *BLEManager) Send(data string) {
 	select {
 	case err := <-done:
 		if err != nil {
-			log.Println("Failed to send data:", err)
 			b.ready = false
-		} else {
-			//fmt.Println("Sent:", data)
+			return fmt.Errorf("failed to send data: %w", err)
 		}
+		return nil
 	case <-time.After(1 * time.Second):
-		log.Println("Send timeout:", data)
 		b.ready = false
+		return ErrSendTimeout
+	}
+}
+
+// Battery reads the battery level, 0..1. ok is false when the device has
+// no battery service or the read failed; a failed read does not affect
+// the connection.
+func (b *BLEManager) Battery() (level float32, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.ready || b.battery == nil {
+		return 0, false
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	buf := make([]byte, 1)
+	done := make(chan result, 1)
+	go func() {
+		n, err := b.battery.Read(buf)
+		done <- result{n, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil || r.n < 1 || buf[0] > 100 {
+			return 0, false
+		}
+		return float32(buf[0]) / 100, true
+	case <-time.After(1 * time.Second):
+		return 0, false
 	}
 }
 
@@ -167,6 +223,7 @@ func (b *BLEManager) Disconnect() {
 		b.device.Disconnect()
 		b.device = bluetooth.Device{}
 		b.char = nil
+		b.battery = nil
 		b.ready = false
 	}
 
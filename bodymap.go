@@ -0,0 +1,354 @@
+// bodymap.go
+package main
+
+import (
+	"image/color"
+	"sort"
+	"time"
+	"touchytails/devicestore"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- Body map ---
+
+// bodyAspect is the width/height ratio of the silhouette box
+const bodyAspect = 0.6
+
+// flashTime is how long a region and marker stay lit after output
+const flashTime = 300 * time.Millisecond
+
+// bodyRegion is a part of the silhouette in 0..1 coordinates of its box
+type bodyRegion struct {
+	name       string
+	x, y, w, h float32
+	round      bool
+}
+
+// Regions are hit-tested in order, so the tail wins over the legs it overlaps.
+// The silhouette is seen from behind: the left arm is on the left.
+var bodyRegions = []bodyRegion{
+	{name: "Head", x: 0.40, y: 0.01, w: 0.20, h: 0.13, round: true},
+	{name: "Tail", x: 0.56, y: 0.46, w: 0.40, h: 0.05},
+	{name: "Torso", x: 0.33, y: 0.15, w: 0.34, h: 0.35},
+	{name: "Left arm", x: 0.15, y: 0.16, w: 0.16, h: 0.38},
+	{name: "Right arm", x: 0.69, y: 0.16, w: 0.16, h: 0.38},
+	{name: "Left leg", x: 0.34, y: 0.51, w: 0.15, h: 0.46},
+	{name: "Right leg", x: 0.51, y: 0.51, w: 0.15, h: 0.46},
+}
+
+var (
+	bodyColor      = color.RGBA{70, 70, 80, 255}
+	bodyLitColor   = color.RGBA{120, 90, 200, 255}
+	markerColor    = color.RGBA{230, 230, 230, 255}
+	markerLitColor = color.RGBA{255, 200, 0, 255}
+)
+
+// bodyView is the active body map, nil until the view is built
+var bodyView *bodyMap
+
+// bodyMap shows a silhouette with a draggable marker per device
+type bodyMap struct {
+	widget.BaseWidget
+	store   *devicestore.DeviceStore
+	console *Console
+	markers map[string]*deviceMarker
+	lit     map[string]time.Time // region name -> lit until
+}
+
+func newBodyMap(store *devicestore.DeviceStore, console *Console) *bodyMap {
+	m := &bodyMap{
+		store:   store,
+		console: console,
+		markers: map[string]*deviceMarker{},
+		lit:     map[string]time.Time{},
+	}
+	m.ExtendBaseWidget(m)
+	return m
+}
+
+// Sync adds, updates and removes markers to match the store. GUI thread only.
+func (m *bodyMap) Sync() {
+	seen := map[string]bool{}
+	unplaced := 0
+	for _, d := range m.store.Snapshot() {
+		seen[d.ID] = true
+		mk, ok := m.markers[d.ID]
+		if !ok {
+			mk = newDeviceMarker(m, d.ID)
+			m.markers[d.ID] = mk
+		}
+		mk.label.Text = d.Name
+		if d.Position != nil {
+			mk.pos = *d.Position
+			mk.placed = true
+		} else {
+			// park unplaced devices in a strip along the bottom
+			mk.pos = devicestore.Position{X: 0.05 + float32(unplaced)*0.12, Y: 0.99}
+			mk.placed = false
+			unplaced++
+		}
+		mk.Refresh()
+	}
+	for id := range m.markers {
+		if !seen[id] {
+			delete(m.markers, id)
+		}
+	}
+	m.Refresh()
+}
+
+// Flash lights up a device marker and the region it sits in
+func (m *bodyMap) Flash(id string) {
+	mk, ok := m.markers[id]
+	if !ok {
+		return
+	}
+	until := time.Now().Add(flashTime)
+	mk.litUntil = until
+	if mk.placed {
+		if r := regionAt(mk.pos); r != nil {
+			m.lit[r.name] = until
+		}
+	}
+	m.Refresh()
+	time.AfterFunc(flashTime, func() { fyne.Do(m.Refresh) })
+}
+
+// Tapped on a region lets the user pick which device sits there; the device
+// is placed at the tap position and buzzed so it can be checked by feel.
+func (m *bodyMap) Tapped(ev *fyne.PointEvent) {
+	pos, ok := m.toBody(ev.Position)
+	if !ok {
+		return
+	}
+	r := regionAt(pos)
+	if r == nil {
+		return
+	}
+
+	var items []*fyne.MenuItem
+	devices := m.store.Snapshot()
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	for _, d := range devices {
+		items = append(items, fyne.NewMenuItem(d.Name, func() {
+			m.store.SetPosition(d.ID, &pos)
+			m.console.Append(d.Name + " placed on " + r.name)
+			sendTestPulse(m.console, d.ID, testPulseValue, "Placed on "+r.name)
+			m.Sync()
+		}))
+	}
+	if len(items) == 0 {
+		return
+	}
+	menu := fyne.NewMenu(r.name, items...)
+	widget.ShowPopUpMenuAtPosition(menu, fyne.CurrentApp().Driver().CanvasForObject(m), ev.AbsolutePosition)
+}
+
+// box returns the silhouette box inside the widget
+func (m *bodyMap) box() (fyne.Position, fyne.Size) {
+	size := m.Size()
+	h := size.Height
+	w := h * bodyAspect
+	if w > size.Width {
+		w = size.Width
+		h = w / bodyAspect
+	}
+	return fyne.NewPos((size.Width-w)/2, (size.Height-h)/2), fyne.NewSize(w, h)
+}
+
+// toBody converts a widget position to body coordinates
+func (m *bodyMap) toBody(p fyne.Position) (devicestore.Position, bool) {
+	origin, size := m.box()
+	if size.Width == 0 || size.Height == 0 {
+		return devicestore.Position{}, false
+	}
+	return devicestore.Position{
+		X: (p.X - origin.X) / size.Width,
+		Y: (p.Y - origin.Y) / size.Height,
+	}, true
+}
+
+func regionAt(p devicestore.Position) *bodyRegion {
+	for i := range bodyRegions {
+		r := &bodyRegions[i]
+		if p.X >= r.x && p.X <= r.x+r.w && p.Y >= r.y && p.Y <= r.y+r.h {
+			return r
+		}
+	}
+	return nil
+}
+
+func (m *bodyMap) CreateRenderer() fyne.WidgetRenderer {
+	r := &bodyMapRenderer{m: m, parts: map[string]fyne.CanvasObject{}}
+	for _, region := range bodyRegions {
+		if region.round {
+			r.parts[region.name] = canvas.NewCircle(bodyColor)
+		} else {
+			rect := canvas.NewRectangle(bodyColor)
+			rect.CornerRadius = 8
+			r.parts[region.name] = rect
+		}
+	}
+	return r
+}
+
+type bodyMapRenderer struct {
+	m     *bodyMap
+	parts map[string]fyne.CanvasObject
+}
+
+func (r *bodyMapRenderer) Layout(size fyne.Size) {
+	origin, box := r.m.box()
+	for _, region := range bodyRegions {
+		part := r.parts[region.name]
+		part.Move(fyne.NewPos(origin.X+region.x*box.Width, origin.Y+region.y*box.Height))
+		part.Resize(fyne.NewSize(region.w*box.Width, region.h*box.Height))
+	}
+	for _, mk := range r.m.markers {
+		ms := mk.MinSize()
+		mk.Resize(ms)
+		mk.Move(fyne.NewPos(
+			origin.X+mk.pos.X*box.Width-markerSize/2,
+			origin.Y+mk.pos.Y*box.Height-markerSize/2,
+		))
+	}
+}
+
+func (r *bodyMapRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(240, 400)
+}
+
+func (r *bodyMapRenderer) Refresh() {
+	now := time.Now()
+	for _, region := range bodyRegions {
+		col := bodyColor
+		if now.Before(r.m.lit[region.name]) {
+			col = bodyLitColor
+		}
+		switch part := r.parts[region.name].(type) {
+		case *canvas.Circle:
+			part.FillColor = col
+		case *canvas.Rectangle:
+			part.FillColor = col
+		}
+		r.parts[region.name].Refresh()
+	}
+	r.Layout(r.m.Size())
+	for _, mk := range r.m.markers {
+		mk.Refresh()
+	}
+}
+
+func (r *bodyMapRenderer) Objects() []fyne.CanvasObject {
+	objs := make([]fyne.CanvasObject, 0, len(bodyRegions)+len(r.m.markers))
+	for _, region := range bodyRegions {
+		objs = append(objs, r.parts[region.name])
+	}
+	ids := make([]string, 0, len(r.m.markers))
+	for id := range r.m.markers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		objs = append(objs, r.m.markers[id])
+	}
+	return objs
+}
+
+func (r *bodyMapRenderer) Destroy() {}
+
+// --- Device marker ---
+
+const markerSize = 18
+
+// deviceMarker is a dot with the device name that can be dragged to place
+// the device and tapped to buzz it
+type deviceMarker struct {
+	widget.BaseWidget
+	m        *bodyMap
+	id       string
+	pos      devicestore.Position
+	placed   bool
+	litUntil time.Time
+	dot      *canvas.Circle
+	label    *canvas.Text
+}
+
+func newDeviceMarker(m *bodyMap, id string) *deviceMarker {
+	mk := &deviceMarker{
+		m:     m,
+		id:    id,
+		dot:   canvas.NewCircle(markerColor),
+		label: canvas.NewText("", color.White),
+	}
+	mk.label.TextSize = 11
+	mk.ExtendBaseWidget(mk)
+	return mk
+}
+
+func (mk *deviceMarker) Dragged(ev *fyne.DragEvent) {
+	_, box := mk.m.box()
+	if box.Width == 0 || box.Height == 0 {
+		return
+	}
+	mk.pos.X = max(0, min(1, mk.pos.X+ev.Dragged.DX/box.Width))
+	mk.pos.Y = max(0, min(1, mk.pos.Y+ev.Dragged.DY/box.Height))
+	mk.m.Refresh()
+}
+
+func (mk *deviceMarker) DragEnd() {
+	pos := mk.pos
+	mk.m.store.SetPosition(mk.id, &pos)
+	mk.placed = true
+	if r := regionAt(pos); r != nil {
+		mk.m.console.Append(mk.label.Text + " placed on " + r.name)
+	}
+}
+
+func (mk *deviceMarker) Tapped(*fyne.PointEvent) {
+	sendTestPulse(mk.m.console, mk.id, testPulseValue, "Body map")
+}
+
+func (mk *deviceMarker) MinSize() fyne.Size {
+	return fyne.NewSize(markerSize, markerSize)
+}
+
+func (mk *deviceMarker) CreateRenderer() fyne.WidgetRenderer {
+	return &markerRenderer{mk: mk}
+}
+
+type markerRenderer struct {
+	mk *deviceMarker
+}
+
+func (r *markerRenderer) Layout(size fyne.Size) {
+	r.mk.dot.Resize(fyne.NewSize(markerSize, markerSize))
+	r.mk.dot.Move(fyne.NewPos(0, 0))
+	r.mk.label.Move(fyne.NewPos(markerSize+2, (markerSize-r.mk.label.MinSize().Height)/2))
+}
+
+func (r *markerRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(markerSize, markerSize)
+}
+
+func (r *markerRenderer) Refresh() {
+	col := markerColor
+	if time.Now().Before(r.mk.litUntil) {
+		col = markerLitColor
+	} else if !r.mk.placed {
+		col = statusColors["Disabled"]
+	}
+	r.mk.dot.FillColor = col
+	r.mk.dot.Refresh()
+	r.mk.label.Refresh()
+	r.Layout(r.mk.Size())
+}
+
+func (r *markerRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.mk.dot, r.mk.label}
+}
+
+func (r *markerRenderer) Destroy() {}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"touchytails/util"
+)
+
+const configFileName = "devices.json"
+
+var configFlag = flag.String("config", "", "path to devices.json (default: "+util.AppDirName+" in the user config directory)")
+
+// resolveConfigPath returns the devices.json to use. Without --config it lives
+// in the user config directory, so the device list no longer depends on the
+// directory the app was started from. migratedFrom is set when an old
+// devices.json was copied over on first run.
+func resolveConfigPath() (path, migratedFrom string, err error) {
+	if *configFlag != "" {
+		return *configFlag, "", nil
+	}
+
+	dir, err := util.ConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+	path = filepath.Join(dir, configFileName)
+
+	if _, err := os.Stat(path); err == nil {
+		return path, "", nil
+	}
+	for _, legacy := range legacyConfigPaths() {
+		if legacy == path {
+			continue
+		}
+		data, err := os.ReadFile(legacy)
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return "", "", fmt.Errorf("migrate %s: %w", legacy, err)
+		}
+		return path, legacy, nil
+	}
+	return path, "", nil
+}
+
+// legacyConfigPaths lists where older versions kept devices.json: the working
+// directory and, for double-clicked builds, the executable's directory.
+func legacyConfigPaths() []string {
+	var paths []string
+	if wd, err := os.Getwd(); err == nil {
+		paths = append(paths, filepath.Join(wd, configFileName))
+	}
+	if exe, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(exe), configFileName))
+	}
+	return paths
+}
@@ -0,0 +1,236 @@
+// console.go
+package main
+
+import (
+	"slices"
+	"touchytails/eventbus"
+	"touchytails/logstore"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- Console handling ---
+
+const (
+	allDevices = "All devices"
+	allLevels  = "All levels"
+)
+
+// lowBattery is the level below which battery reports are warnings
+const lowBattery = 0.2
+
+// Console shows the log store in a virtualized list that can be filtered by
+// device and level, searched and paused. Writing is safe from any goroutine;
+// the list catches up once per UI frame instead of redrawing for every line.
+type Console struct {
+	logs   *logstore.Store
+	list   *widget.List
+	shown  []logstore.Entry // entries on screen, GUI thread only
+	filter logstore.Filter
+	paused bool
+	seen   uint64 // log sequence last shown
+
+	level  *widget.Select
+	device *widget.Select
+	search *widget.Entry
+	pause  *widget.Check
+}
+
+func newConsole(logs *logstore.Store) *Console {
+	c := &Console{logs: logs}
+	c.list = widget.NewList(
+		func() int { return len(c.shown) },
+		func() fyne.CanvasObject {
+			l := widget.NewLabel("")
+			l.TextStyle.Monospace = true
+			l.Truncation = fyne.TextTruncateEllipsis
+			return l
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			l := o.(*widget.Label)
+			e := c.shown[i]
+			switch e.Level {
+			case logstore.LevelDebug:
+				l.Importance = widget.LowImportance
+			case logstore.LevelWarn:
+				l.Importance = widget.WarningImportance
+			case logstore.LevelError:
+				l.Importance = widget.DangerImportance
+			default:
+				l.Importance = widget.MediumImportance
+			}
+			l.SetText(e.String())
+		},
+	)
+
+	levels := []string{allLevels}
+	for _, l := range logstore.Levels[1:] {
+		levels = append(levels, l.String()+" and up")
+	}
+	c.level = widget.NewSelect(levels, nil)
+	c.level.Selected = allLevels
+	c.level.OnChanged = func(choice string) {
+		c.filter.MinLevel = logstore.LevelDebug
+		for i, opt := range levels {
+			if opt == choice {
+				c.filter.MinLevel = logstore.Levels[i]
+			}
+		}
+		c.reload()
+	}
+
+	c.device = widget.NewSelect([]string{allDevices}, nil)
+	c.device.Selected = allDevices
+	c.device.OnChanged = func(choice string) {
+		c.filter.Device = ""
+		if choice != allDevices {
+			c.filter.Device = choice
+		}
+		c.reload()
+	}
+
+	c.search = widget.NewEntry()
+	c.search.SetPlaceHolder("Search log...")
+	c.search.OnChanged = func(text string) {
+		c.filter.Search = text
+		c.reload()
+	}
+
+	c.pause = widget.NewCheck("Pause", func(paused bool) {
+		c.paused = paused
+		if !paused {
+			c.reload()
+		}
+	})
+	return c
+}
+
+// object returns the console with its filter bar, at least minHeight tall
+func (c *Console) object(minHeight float32) fyne.CanvasObject {
+	bar := container.NewBorder(nil, nil, container.NewHBox(c.level, c.device), c.pause, c.search)
+	spacer := canvas.NewRectangle(nil)
+	spacer.SetMinSize(fyne.NewSize(0, minHeight))
+	return container.NewStack(spacer, container.NewBorder(bar, nil, nil, nil, c.list))
+}
+
+// Append logs an app-wide info line
+func (c *Console) Append(line string) {
+	c.Log(logstore.LevelInfo, "", "", line)
+}
+
+// Log records an entry; device is a device name or empty
+func (c *Console) Log(level logstore.Level, device, source, msg string) {
+	c.logs.Add(logstore.Entry{Level: level, Device: device, Source: source, Message: msg})
+}
+
+// LogEvent records a bus event with a level and device that fit it
+func (c *Console) LogEvent(e eventbus.Event) {
+	c.logs.Add(eventEntry(e))
+}
+
+// update appends new entries unless the console is paused, dropping
+// those that fell out of the log store. It only re-reads everything when
+// it fell too far behind. GUI thread only.
+func (c *Console) update() {
+	if c.paused || c.logs.Seq() == c.seen {
+		return
+	}
+	added, last, ok := c.logs.Since(c.seen, c.filter)
+	if !ok {
+		c.reload()
+		return
+	}
+	c.seen = last
+
+	first := c.logs.First()
+	drop := 0
+	for drop < len(c.shown) && c.shown[drop].Seq < first {
+		drop++
+	}
+	c.shown = append(slices.Delete(c.shown, 0, drop), added...)
+
+	for _, e := range added {
+		if e.Device != "" && !slices.Contains(c.device.Options, e.Device) {
+			c.syncDevices()
+			break
+		}
+	}
+	if drop > 0 || len(added) > 0 {
+		c.list.Refresh()
+		c.list.ScrollToBottom()
+	}
+}
+
+// reload re-reads the filtered entries and scrolls to the newest one.
+// GUI thread only.
+func (c *Console) reload() {
+	if c.paused {
+		return
+	}
+	c.shown, c.seen = c.logs.Entries(c.filter)
+	c.syncDevices()
+
+	c.list.Refresh()
+	c.list.ScrollToBottom()
+}
+
+// syncDevices offers every device name in the log store in the device
+// filter. GUI thread only.
+func (c *Console) syncDevices() {
+	devices := append([]string{allDevices}, c.logs.Devices()...)
+	if len(devices) != len(c.device.Options) {
+		c.device.SetOptions(devices)
+	}
+}
+
+// eventEntry turns a bus event into a log entry
+func eventEntry(e eventbus.Event) logstore.Entry {
+	entry := logstore.Entry{Level: logstore.LevelInfo, Message: e.String()}
+	switch ev := e.(type) {
+	case eventbus.DeviceConnecting:
+		entry.Device, entry.Source = ev.Name, "ble"
+	case eventbus.DeviceConnected:
+		entry.Device, entry.Source = ev.Name, "ble"
+	case eventbus.DeviceDisconnected:
+		entry.Device, entry.Source = ev.Name, "ble"
+		if !ev.Disabled {
+			entry.Level = logstore.LevelWarn
+		}
+	case eventbus.ConnectFailed:
+		entry.Device, entry.Source, entry.Level = ev.Name, "ble", logstore.LevelWarn
+	case eventbus.DeviceStateChanged:
+		entry.Device, entry.Source = ev.Name, "state"
+		if ev.To == "Malfunction" {
+			entry.Level = logstore.LevelError
+		}
+	case eventbus.TransitionRejected:
+		entry.Device, entry.Source, entry.Level = ev.Name, "state", logstore.LevelWarn
+	case eventbus.SendFailed:
+		entry.Device, entry.Source, entry.Level = ev.Name, "output", logstore.LevelWarn
+	case eventbus.OutputSent:
+		entry.Device, entry.Source, entry.Level = ev.Name, "output", logstore.LevelDebug
+	case eventbus.LimitChanged:
+		entry.Device, entry.Source = ev.Name, "limits"
+		if ev.Limit != "" {
+			entry.Level = logstore.LevelWarn
+		}
+	case eventbus.BatteryChanged:
+		entry.Device, entry.Source = ev.Name, "ble"
+		if ev.Level < lowBattery {
+			entry.Level = logstore.LevelWarn
+		}
+	case eventbus.PanicStop:
+		entry.Source, entry.Level = "output", logstore.LevelWarn
+	case eventbus.OSCReceived:
+		entry.Source, entry.Level = "osc", logstore.LevelDebug
+	case eventbus.ScanResult:
+		entry.Source = "ble"
+		if !ev.Target {
+			entry.Level = logstore.LevelDebug
+		}
+	}
+	return entry
+}
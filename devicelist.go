@@ -0,0 +1,495 @@
+// devicelist.go
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"slices"
+	"sort"
+	"strings"
+	"touchytails/devicestore"
+	"touchytails/logstore"
+	"touchytails/outputmanager"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- Device list ---
+
+var deviceColumns = []string{"ID", "Name", "Status", "Output", "Test", "Enabled", "Event", "Group", "Limits", "Remove"}
+
+const (
+	sortByName   = "Name"
+	sortByStatus = "Status"
+)
+
+// deviceView is the device list in the Devices tab
+var deviceView *deviceList
+
+// mainWindow is used as parent for dialogs opened from device rows
+var mainWindow fyne.Window
+
+// deviceList shows one row per device, keyed by device ID, with grouped
+// devices under a collapsible item of their group. Sync updates, adds,
+// removes and moves rows in place, so rows that didn't change keep their
+// widgets, focus and any half-typed text.
+type deviceList struct {
+	console *Console
+	rows    *fyne.Container // ungrouped device rows in display order
+	byID    map[string]*deviceRow
+	sortBy  *widget.Select
+
+	groups    *widget.Accordion // one item per group, in store order
+	byGroup   map[string]*groupSection
+	groupsSig string // group names the accordion was built for
+}
+
+func newDeviceList(console *Console) *deviceList {
+	l := &deviceList{
+		console: console,
+		rows:    container.NewVBox(),
+		byID:    make(map[string]*deviceRow),
+		groups:  widget.NewAccordion(),
+		byGroup: make(map[string]*groupSection),
+	}
+	l.groups.MultiOpen = true
+	// the next UI frame applies a new sort order
+	l.sortBy = widget.NewSelect([]string{sortByName, sortByStatus}, nil)
+	l.sortBy.Selected = sortByName
+	return l
+}
+
+func (l *deviceList) object() fyne.CanvasObject {
+	header := container.NewGridWithColumns(len(deviceColumns))
+	for _, title := range deviceColumns {
+		header.Add(widget.NewLabelWithStyle(title, fyne.TextAlignCenter, fyne.TextStyle{Bold: true}))
+	}
+	top := container.NewVBox(
+		container.NewHBox(widget.NewLabel("Sort by"), l.sortBy),
+		header,
+	)
+	// Ungrouped devices first, then one collapsible item per group
+	return container.NewBorder(top, nil, nil, nil, container.NewVScroll(container.NewVBox(l.rows, l.groups)))
+}
+
+// Sync brings the rows in line with the store. limits holds the limit
+// currently reducing each device's output and stats the output manager's
+// send stats, both by device ID. GUI thread only.
+func (l *deviceList) Sync(limits map[string]string, stats map[string]outputmanager.Stats) {
+	devices := store.Snapshot()
+	l.sortDevices(devices)
+	l.syncGroups()
+
+	options := groupOptions(store)
+	order := map[*fyne.Container][]fyne.CanvasObject{l.rows: nil}
+	for _, sec := range l.byGroup {
+		order[sec.rows] = nil
+	}
+	seen := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		seen[d.ID] = true
+		row, ok := l.byID[d.ID]
+		if !ok {
+			row = newDeviceRow(d, l.console)
+			l.byID[d.ID] = row
+		}
+		row.update(d, limits, options)
+		row.meter.set(stats[d.ID])
+
+		parent := l.rows
+		if sec, ok := l.byGroup[d.Group]; ok {
+			parent = sec.rows
+		}
+		order[parent] = append(order[parent], row.obj)
+	}
+	for id := range l.byID {
+		if !seen[id] {
+			delete(l.byID, id)
+		}
+	}
+
+	for parent, objs := range order {
+		if !slices.Equal(objs, parent.Objects) {
+			parent.Objects = objs
+			parent.Refresh()
+		}
+	}
+}
+
+func (l *deviceList) sortDevices(devices []devicestore.Device) {
+	byName := func(a, b devicestore.Device) bool {
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	}
+	sort.SliceStable(devices, func(i, j int) bool {
+		a, b := devices[i], devices[j]
+		if l.sortBy.Selected == sortByStatus && a.State != b.State {
+			return a.State < b.State
+		}
+		return byName(a, b)
+	})
+}
+
+// syncGroups shows the current group settings and rebuilds the accordion
+// when groups are added or removed. Items of groups that still exist are
+// reused, so collapsed groups stay collapsed.
+func (l *deviceList) syncGroups() {
+	groups := store.Groups()
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.Name
+		sec, ok := l.byGroup[g.Name]
+		if !ok {
+			sec = newGroupSection(g, l.console)
+			l.byGroup[g.Name] = sec
+		}
+		sec.update(g)
+	}
+
+	sig := strings.Join(names, "\x00")
+	if sig == l.groupsSig {
+		return
+	}
+	l.groupsSig = sig
+
+	items := make([]*widget.AccordionItem, len(groups))
+	for i, g := range groups {
+		items[i] = l.byGroup[g.Name].item
+	}
+	for name := range l.byGroup {
+		if !slices.Contains(names, name) {
+			delete(l.byGroup, name)
+		}
+	}
+	l.groups.Items = items
+	l.groups.Refresh()
+}
+
+// --- Device row ---
+
+// deviceRow holds the widgets of one device. syncing is set while update
+// writes store values into the widgets, so their handlers don't write the
+// same values back.
+type deviceRow struct {
+	obj     fyne.CanvasObject
+	name    *widget.Entry
+	event   *widget.Entry
+	status  *canvas.Text
+	meter   *meter
+	enabled *widget.Check
+	group   *widget.Select
+	syncing bool
+}
+
+func newDeviceRow(d devicestore.Device, console *Console) *deviceRow {
+	r := &deviceRow{
+		name:   widget.NewEntry(),
+		event:  widget.NewEntry(),
+		status: newStatus(d.State.String()),
+		meter:  newMeter(),
+	}
+
+	idLabel := canvas.NewText(d.ID, color.White)
+	idLabel.TextSize = 6
+	idLabel.Alignment = fyne.TextAlignCenter
+
+	// --- Handlers ---
+	onToggleEnabled := func(enabled bool) {
+		if r.syncing {
+			return
+		}
+		if !enabled {
+			if ble := store.DetachBLE(d.ID); ble != nil {
+				ble.Disconnect()
+			}
+		}
+		store.SetEnabled(d.ID, enabled)
+		store.ScheduleSave()
+		if enabled {
+			console.Append("Enabled " + d.ID)
+		} else {
+			console.Append("Disabled " + d.ID)
+		}
+	}
+
+	onRemove := func() {
+		store.Remove(d.ID)
+		store.ScheduleSave()
+	}
+
+	// Edits are validated and saved by the store after a short pause
+	r.name.Validator = func(text string) error { return store.ValidateName(d.ID, text) }
+	r.event.Validator = devicestore.ValidateEvent
+	r.name.OnChanged = func(newName string) {
+		if !r.syncing {
+			store.SetName(d.ID, newName)
+		}
+	}
+	r.event.OnChanged = func(newEvent string) {
+		if !r.syncing {
+			store.SetEvent(d.ID, newEvent)
+		}
+	}
+
+	r.group = widget.NewSelect(nil, nil)
+	r.group.OnChanged = func(choice string) {
+		if r.syncing {
+			return
+		}
+		current, _ := store.Get(d.ID)
+		switch choice {
+		case groupLabel(current.Group):
+			return
+		case newGroupOption:
+			r.group.SetSelected(groupLabel(current.Group))
+			askGroupName(func(name string) {
+				if err := store.SetDeviceGroup(d.ID, name); err != nil {
+					console.Log(logstore.LevelWarn, "", "", "Group not set: "+err.Error())
+				}
+			})
+		case noGroupOption:
+			store.SetDeviceGroup(d.ID, "")
+		default:
+			store.SetDeviceGroup(d.ID, choice)
+		}
+	}
+
+	// --- Widgets ---
+	testBtn := widget.NewButton("Test", func() { showTestPanel(d.ID, console) })
+	r.enabled = widget.NewCheck("Enabled", onToggleEnabled)
+	limitsBtn := widget.NewButton("Limits", func() { askLimits(d.ID, console) })
+	removeBtn := widget.NewButton("Remove", onRemove)
+
+	// --- Layout ---
+	r.obj = container.NewGridWithColumns(len(deviceColumns),
+		idLabel, r.name, r.status, r.meter.obj, testBtn, r.enabled, r.event, r.group, limitsBtn, removeBtn,
+	)
+	return r
+}
+
+// update shows the current settings and state of d. Entries the user is
+// typing in are left alone. GUI thread only.
+func (r *deviceRow) update(d devicestore.Device, limits map[string]string, groupOpts []string) {
+	r.syncing = true
+	defer func() { r.syncing = false }()
+
+	focused := mainWindow.Canvas().Focused()
+	if r.name.Text != d.Name && focused != r.name {
+		r.name.SetText(d.Name)
+	}
+	if r.event.Text != d.Event && focused != r.event {
+		r.event.SetText(d.Event)
+	}
+	if r.enabled.Checked != d.Enabled {
+		r.enabled.SetChecked(d.Enabled)
+	}
+	if !slices.Equal(r.group.Options, groupOpts) {
+		r.group.SetOptions(groupOpts)
+	}
+	if r.group.Selected != groupLabel(d.Group) {
+		r.group.SetSelected(groupLabel(d.Group))
+	}
+
+	state := d.State.String()
+	text := state
+	if note := limits[d.ID]; note != "" {
+		text += ": " + note
+	}
+	if r.status.Text != text {
+		applyStatus(r.status, state)
+		if text != state {
+			r.status.Text = text
+			r.status.Refresh()
+		}
+	}
+}
+
+// --- Output meter ---
+
+var (
+	meterBackground = color.RGBA{50, 50, 55, 255}
+	meterFill       = color.RGBA{0, 160, 0, 255}
+	meterLimited    = color.RGBA{220, 130, 0, 255}
+)
+
+// meter is a small bar showing the level a device is at and how often it
+// is written to. It turns orange while a limit reduces or holds back output.
+type meter struct {
+	obj   *fyne.Container
+	bg    *canvas.Rectangle
+	fill  *canvas.Rectangle
+	text  *canvas.Text
+	value float32
+	shown outputmanager.Stats
+}
+
+func newMeter() *meter {
+	m := &meter{
+		bg:   canvas.NewRectangle(meterBackground),
+		fill: canvas.NewRectangle(meterFill),
+		text: canvas.NewText("", color.White),
+	}
+	m.text.TextSize = 11
+	m.text.Alignment = fyne.TextAlignCenter
+	m.obj = container.New(m, m.bg, m.fill, m.text)
+	return m
+}
+
+// set shows st, redrawing only when it changed. GUI thread only.
+func (m *meter) set(st outputmanager.Stats) {
+	if st == m.shown {
+		return
+	}
+	m.shown = st
+	m.value = max(0, min(1, st.Value))
+
+	text := fmt.Sprintf("%.0f%%  %.0f/s", m.value*100, st.Rate)
+	switch {
+	case st.Blocked:
+		text = "held back"
+	case st.Limit != "":
+		text += " capped"
+	}
+	m.text.Text = text
+	m.fill.FillColor = meterFill
+	if st.Limit != "" {
+		m.fill.FillColor = meterLimited
+	}
+	m.obj.Refresh()
+}
+
+// Layout implements fyne.Layout: the fill grows from the left with the value
+func (m *meter) Layout(_ []fyne.CanvasObject, size fyne.Size) {
+	bar := fyne.NewSize(size.Width, size.Height*0.6)
+	top := fyne.NewPos(0, (size.Height-bar.Height)/2)
+	m.bg.Move(top)
+	m.bg.Resize(bar)
+	m.fill.Move(top)
+	m.fill.Resize(fyne.NewSize(bar.Width*m.value, bar.Height))
+	m.text.Move(fyne.NewPos(0, (size.Height-m.text.MinSize().Height)/2))
+	m.text.Resize(fyne.NewSize(size.Width, m.text.MinSize().Height))
+}
+
+func (m *meter) MinSize(_ []fyne.CanvasObject) fyne.Size {
+	return fyne.NewSize(60, m.text.MinSize().Height+4)
+}
+
+// --- Groups ---
+
+const (
+	noGroupOption  = "(none)"
+	newGroupOption = "New group..."
+)
+
+func groupOptions(store *devicestore.DeviceStore) []string {
+	options := []string{noGroupOption}
+	for _, g := range store.Groups() {
+		options = append(options, g.Name)
+	}
+	return append(options, newGroupOption)
+}
+
+func groupLabel(name string) string {
+	if name == "" {
+		return noGroupOption
+	}
+	return name
+}
+
+func askGroupName(onName func(name string)) {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("e.g. Tail, Left arm")
+	dialog.ShowForm("New group", "Create", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Name", entry)},
+		func(ok bool) {
+			if ok && strings.TrimSpace(entry.Text) != "" {
+				onName(entry.Text)
+			}
+		}, mainWindow)
+}
+
+// groupSection is the accordion item of one group: the group-wide enable,
+// intensity and binding controls above the member rows. syncing works as in
+// deviceRow.
+type groupSection struct {
+	item      *widget.AccordionItem
+	rows      *fyne.Container // member rows in display order
+	enabled   *widget.Check
+	intensity *widget.Slider
+	percent   *widget.Label
+	event     *widget.Entry
+	shown     *devicestore.Group // settings last written into the widgets
+	syncing   bool
+}
+
+func newGroupSection(g devicestore.Group, console *Console) *groupSection {
+	sec := &groupSection{
+		rows:      container.NewVBox(),
+		intensity: widget.NewSlider(0, 1),
+		percent:   widget.NewLabel(""),
+		event:     widget.NewEntry(),
+	}
+
+	sec.enabled = widget.NewCheck("Group enabled", func(enabled bool) {
+		if sec.syncing {
+			return
+		}
+		store.SetGroupEnabled(g.Name, enabled)
+		console.Append(fmt.Sprintf("Group %s enabled: %v", g.Name, enabled))
+	})
+
+	sec.intensity.Step = 0.05
+	sec.intensity.OnChanged = func(v float64) {
+		sec.percent.SetText(fmt.Sprintf("Intensity %.0f%%", v*100))
+		if !sec.syncing {
+			store.SetGroupIntensity(g.Name, float32(v))
+		}
+	}
+
+	sec.event.SetPlaceHolder("Group event")
+	sec.event.Validator = devicestore.ValidateEvent
+	sec.event.OnChanged = func(event string) {
+		if !sec.syncing {
+			store.SetGroupEvent(g.Name, event)
+		}
+	}
+
+	deleteBtn := widget.NewButton("Delete group", func() {
+		store.RemoveGroup(g.Name)
+		console.Append("Deleted group " + g.Name)
+	})
+
+	controls := container.NewGridWithColumns(4,
+		sec.enabled,
+		container.NewBorder(nil, nil, sec.percent, nil, sec.intensity),
+		sec.event,
+		deleteBtn,
+	)
+	sec.item = widget.NewAccordionItem(g.Name, container.NewVBox(controls, sec.rows))
+	sec.item.Open = true
+	return sec
+}
+
+// update shows the current settings of g, e.g. after a change through the
+// API, OSC or a profile import. GUI thread only.
+func (sec *groupSection) update(g devicestore.Group) {
+	// The slider snaps to its step, so compare with what was shown last
+	if sec.shown != nil && *sec.shown == g {
+		return
+	}
+	sec.shown = &g
+	sec.syncing = true
+	defer func() { sec.syncing = false }()
+
+	if sec.enabled.Checked != g.Enabled {
+		sec.enabled.SetChecked(g.Enabled)
+	}
+	sec.intensity.SetValue(float64(g.Intensity))
+	sec.percent.SetText(fmt.Sprintf("Intensity %.0f%%", g.Intensity*100))
+	if sec.event.Text != g.Event && mainWindow.Canvas().Focused() != sec.event {
+		sec.event.SetText(g.Event)
+	}
+}
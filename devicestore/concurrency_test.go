@@ -0,0 +1,98 @@
+package devicestore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentEditsAndLookups edits devices while OSC processing and the
+// scan path look them up. Run with -race.
+func TestConcurrentEditsAndLookups(t *testing.T) {
+	s := newTestStore(t)
+	for i := range 4 {
+		id := fmt.Sprintf("dev-%d", i)
+		addTestDevice(s, id, fmt.Sprintf("Device %d", i))
+		s.Transition(id, StateConnecting, "")
+		s.Transition(id, StateOnline, "")
+		s.SetBLE(id, &fakeLink{ready: true})
+	}
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				fn(i)
+			}
+		}()
+	}
+
+	// Edits from the device list and the wizard
+	run(func(i int) { s.SetName(fmt.Sprintf("dev-%d", i%4), fmt.Sprintf("Name %d", i)) })
+	run(func(i int) { s.SetEvent(fmt.Sprintf("dev-%d", i%4), fmt.Sprintf("Touch%d", i%3)) })
+	// Devices are added and removed while the scan path checks for them
+	run(func(i int) {
+		id := fmt.Sprintf("new-%d", i)
+		s.Add(&Device{ID: id, Name: "Device " + NextDeviceLetter(s), Enabled: true})
+		s.Remove(id)
+	})
+	run(func(i int) { s.Exists(fmt.Sprintf("new-%d", i)) })
+	// OSC parameters and commands look devices up
+	run(func(i int) {
+		for _, tg := range s.Targets(fmt.Sprintf("Touch%d", i%3)) {
+			_ = tg.Name + tg.Event
+		}
+	})
+	run(func(i int) { s.Lookup(fmt.Sprintf("Name %d", i)) })
+	run(func(i int) {
+		for _, d := range s.Snapshot() {
+			_ = d.Name
+		}
+	})
+	wg.Wait()
+
+	for i := range 4 {
+		if dev, ok := s.Get(fmt.Sprintf("dev-%d", i)); !ok || dev.Name == "" {
+			t.Errorf("dev-%d lost: %+v", i, dev)
+		}
+	}
+}
+
+// TestConcurrentRenames gives many devices the same name at once; exactly
+// one may get it
+func TestConcurrentRenames(t *testing.T) {
+	s := newTestStore(t)
+	const devices = 8
+	for i := range devices {
+		addTestDevice(s, fmt.Sprintf("dev-%d", i), fmt.Sprintf("Device %d", i))
+	}
+
+	for round := range 50 {
+		name := fmt.Sprintf("Tail %d", round)
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := range devices {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				s.SetName(fmt.Sprintf("dev-%d", i), name)
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		named := 0
+		for _, d := range s.Snapshot() {
+			if d.Name == name {
+				named++
+			}
+		}
+		if named != 1 {
+			t.Fatalf("%d devices named %q, want 1", named, name)
+		}
+	}
+}
@@ -2,39 +2,72 @@
 package devicestore
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"touchytails/blemanager"
+	"touchytails/eventbus"
 )
 
-type RuntimeManager struct {
-	console guiConsole // interface to send GUI updates
-	active  map[string]struct{}
-	mu      sync.Mutex
+const (
+	pollInterval          = 1 * time.Second // how often Run looks for devices to connect
+	heartbeatInterval     = 2 * time.Second // ping period while a device is online
+	batteryInterval       = time.Minute     // battery read period while online
+	maxConcurrentConnects = 2               // simultaneous connection attempts
+)
+
+// Connector opens a new, not yet connected Link for one attempt
+type Connector func() Link
+
+// BLEConnector connects over Bluetooth
+func BLEConnector() Link {
+	return blemanager.New()
 }
 
-// guiConsole is minimal interface for RunBLEManagers
-type guiConsole interface {
-	Append(msg string)
-	ApplyStatus(dev *Device, status string)
+type RuntimeManager struct {
+	bus     *eventbus.Bus // device events for the GUI, logger and others
+	connect Connector
+	clock   Clock
+	sched   *ConnectScheduler
+	// heartbeat is the ping period, heartbeatInterval outside of tests
+	heartbeat time.Duration
+	active    map[string]struct{}
+	mu        sync.Mutex
+	wg        sync.WaitGroup
 }
 
-// NewRuntimeManager creates a new runtime BLE manager for devices
-func NewRuntimeManager(console guiConsole) *RuntimeManager {
+// NewRuntimeManager creates a new runtime manager that opens links with
+// connect and times retries with clock
+func NewRuntimeManager(bus *eventbus.Bus, connect Connector, clock Clock) *RuntimeManager {
 	return &RuntimeManager{
-		console: console,
-		active:  make(map[string]struct{}),
+		bus:       bus,
+		connect:   connect,
+		clock:     clock,
+		sched:     NewConnectScheduler(maxConcurrentConnects, clock),
+		heartbeat: heartbeatInterval,
+		active:    make(map[string]struct{}),
 	}
 }
 
-// Run starts BLE management loop
-func (rm *RuntimeManager) Run(store *DeviceStore) {
+// MarkSeen tells the scheduler a device was just seen in a scan
+func (rm *RuntimeManager) MarkSeen(id string) {
+	rm.sched.MarkSeen(id)
+}
+
+// Run starts BLE management loop. It stops when ctx is cancelled; every
+// connected device then gets a stop command and is disconnected.
+func (rm *RuntimeManager) Run(ctx context.Context, store *DeviceStore) {
+	rm.wg.Add(1)
 	go func() {
+		defer rm.wg.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
 		for {
-			for _, dev := range store.All() {
-				if !dev.Enabled {
+			for _, dev := range store.Snapshot() {
+				if !store.IsEnabled(dev.ID) || !rm.sched.Due(dev.ID) {
 					continue
 				}
 
@@ -48,56 +81,126 @@ func (rm *RuntimeManager) Run(store *DeviceStore) {
 				rm.mu.Unlock()
 
 				// Start device management
-				go rm.manageDevice(store, dev)
+				rm.wg.Add(1)
+				go rm.manageDevice(ctx, store, dev)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
 			}
-			time.Sleep(3 * time.Second)
 		}
 	}()
 }
 
-// manageDevice handles connection/heartbeat for a single device
-func (rm *RuntimeManager) manageDevice(store *DeviceStore, dev *Device) {
+// Wait blocks until every device goroutine has finished or timeout passes.
+// It reports whether the shutdown completed in time.
+func (rm *RuntimeManager) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		rm.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// manageDevice makes one connection attempt and, if it succeeds, runs the
+// heartbeat until the link drops. Retries are left to Run and the scheduler.
+func (rm *RuntimeManager) manageDevice(ctx context.Context, store *DeviceStore, dev Device) {
+	defer rm.wg.Done()
 	defer func() {
 		rm.mu.Lock()
 		delete(rm.active, dev.ID)
 		rm.mu.Unlock()
 	}()
 
-	ble := blemanager.New()
-	store.SetBLE(dev.ID, ble)
-
-	for store.IsEnabled(dev.ID) {
-		rm.console.Append(fmt.Sprintf("Scanning/connecting to %s (%s)...", dev.Name, dev.ID))
-
-		ble := blemanager.New() // <-- create a fresh one each attempt
-		store.SetBLE(dev.ID, ble)
+	if !rm.sched.Acquire(ctx) {
+		return
+	}
+	if !store.IsEnabled(dev.ID) || ctx.Err() != nil {
+		rm.sched.Release()
+		return
+	}
+	rm.transition(store, dev, StateConnecting, "")
+	rm.bus.Publish(eventbus.DeviceConnecting{ID: dev.ID, Name: dev.Name})
 
-		if err := ble.ConnectDevice(dev.ID); err != nil {
-			rm.console.Append(fmt.Sprintf("Failed to connect %s: %v", dev.Name, err))
-			store.ClearBLE(dev.ID) // cleanup reference
-			time.Sleep(5 * time.Second)
-			continue
+	ble := rm.connect()
+	store.SetBLE(dev.ID, ble)
+	err := ble.ConnectDevice(dev.ID)
+	rm.sched.Release()
+
+	if err != nil {
+		delay := rm.sched.Failure(dev.ID)
+		rm.bus.Publish(eventbus.ConnectFailed{ID: dev.ID, Name: dev.Name, Err: err, RetryIn: delay})
+		store.ClearBLE(dev.ID) // cleanup reference
+		if errors.Is(err, blemanager.ErrServiceNotFound) || errors.Is(err, blemanager.ErrCharacteristicNotFound) {
+			rm.transition(store, dev, StateMalfunction, "incompatible firmware: "+err.Error())
+		} else {
+			rm.transition(store, dev, StateOffline, err.Error())
 		}
-
-		rm.console.Append(fmt.Sprintf("%s connected!", dev.Name))
-		store.SetOnline(dev.ID, true)
-		rm.console.ApplyStatus(dev, "Online")
-
-		// Heartbeat loop
-		for store.IsEnabled(dev.ID) && ble.Ready() {
-			ble.Send("ping")
-			time.Sleep(2 * time.Second)
+		return
+	}
+	rm.sched.Success(dev.ID)
+
+	rm.transition(store, dev, StateOnline, "")
+	rm.bus.Publish(eventbus.DeviceConnected{ID: dev.ID, Name: dev.Name})
+
+	// Heartbeat loop, reading the battery every batteryInterval
+	stopping := false
+	var batteryAt time.Time
+	for !stopping && store.IsEnabled(dev.ID) && ble.Ready() {
+		err := ble.Send("ping")
+		store.RecordSendResult(dev.ID, err)
+		if err != nil {
+			rm.bus.Publish(eventbus.SendFailed{ID: dev.ID, Name: dev.Name, Data: "ping", Err: err})
+			// A timeout may pass, so keep pinging until RecordSendResult
+			// marks the device as malfunctioning
+			if !errors.Is(err, blemanager.ErrSendTimeout) || store.StateOf(dev.ID) == StateMalfunction {
+				break
+			}
 		}
+		if now := rm.clock.Now(); now.Sub(batteryAt) >= batteryInterval {
+			batteryAt = now
+			if level, ok := ble.Battery(); ok && store.SetBattery(dev.ID, level) {
+				rm.bus.Publish(eventbus.BatteryChanged{ID: dev.ID, Name: dev.Name, Level: level})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			stopping = true
+		case <-time.After(rm.heartbeat):
+		}
+	}
 
-		// Disconnect and cleanup
-		ble.Disconnect()
-		store.SetOnline(dev.ID, false)
-		store.ClearBLE(dev.ID)
-		rm.console.ApplyStatus(dev, "Offline")
+	// Disconnect and cleanup
+	if stopping {
+		ble.Send(blemanager.StopCommand)
+	}
+	ble.Disconnect()
+	store.ClearBLE(dev.ID)
+	disabled := !store.IsEnabled(dev.ID)
+	if store.StateOf(dev.ID) == StateMalfunction {
+		rm.sched.Failure(dev.ID) // don't reconnect straight away
+	}
+	switch {
+	case disabled:
+		rm.transition(store, dev, StateDisabled, "")
+	case store.StateOf(dev.ID) != StateMalfunction:
+		rm.transition(store, dev, StateOffline, "connection lost")
+	}
+	rm.bus.Publish(eventbus.DeviceDisconnected{ID: dev.ID, Name: dev.Name, Disabled: disabled})
+}
 
-		if !store.IsEnabled(dev.ID) {
-			rm.console.ApplyStatus(dev, "Disabled")
-			return
-		}
+// transition moves a device to a new state and reports a move the state
+// machine rejects on the bus
+func (rm *RuntimeManager) transition(store *DeviceStore, dev Device, to State, reason string) {
+	if err := store.Transition(dev.ID, to, reason); err != nil {
+		rm.bus.Publish(eventbus.TransitionRejected{ID: dev.ID, Name: dev.Name, To: to.String(), Err: err})
 	}
 }
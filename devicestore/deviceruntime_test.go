@@ -0,0 +1,183 @@
+package devicestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"touchytails/blemanager"
+	"touchytails/eventbus"
+)
+
+func TestRuntimeConcurrentConnects(t *testing.T) {
+	store := newTestStore(t)
+	for i := range 5 {
+		addTestDevice(store, fmt.Sprintf("dev-%d", i), fmt.Sprintf("Device %d", i))
+	}
+
+	var mu sync.Mutex
+	inFlight, most, attempts := 0, 0, 0
+	release := make(chan struct{})
+	connect := func() Link {
+		return &fakeLink{connect: func(string) error {
+			mu.Lock()
+			inFlight++
+			attempts++
+			most = max(most, inFlight)
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return errors.New("out of range")
+		}}
+	}
+
+	rm := NewRuntimeManager(eventbus.New(), connect, newFakeClock())
+	ctx, cancel := context.WithCancel(context.Background())
+	rm.Run(ctx, store)
+
+	waitFor(t, "the first attempts", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return inFlight == maxConcurrentConnects
+	})
+	time.Sleep(50 * time.Millisecond) // give extra attempts a chance to start
+	mu.Lock()
+	if most != maxConcurrentConnects {
+		t.Errorf("%d attempts at once, want %d", most, maxConcurrentConnects)
+	}
+	mu.Unlock()
+
+	close(release)
+	waitFor(t, "every device to fail once", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts >= 5
+	})
+	cancel()
+	if !rm.Wait(time.Second) {
+		t.Fatal("runtime did not stop")
+	}
+	if most > maxConcurrentConnects {
+		t.Errorf("%d attempts at once, want at most %d", most, maxConcurrentConnects)
+	}
+	for i := range 5 {
+		id := fmt.Sprintf("dev-%d", i)
+		if st := store.StateOf(id); st != StateOffline {
+			t.Errorf("%s is %s after a failed attempt, want Offline", id, st)
+		}
+	}
+}
+
+// eventNames reads n events and names them by type, adding the new state
+// to state changes
+func eventNames(t *testing.T, events <-chan eventbus.Event, n int) []string {
+	t.Helper()
+	var names []string
+	for range n {
+		select {
+		case e := <-events:
+			name := fmt.Sprintf("%T", e)[len("eventbus."):]
+			if sc, ok := e.(eventbus.DeviceStateChanged); ok {
+				name += " " + sc.To
+			}
+			names = append(names, name)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after events %v", names)
+		}
+	}
+	return names
+}
+
+// startRuntime runs a runtime for one device on link, pinging every
+// heartbeat, and publishes state changes on the bus like the app does
+func startRuntime(t *testing.T, link *fakeLink, heartbeat time.Duration) (store *DeviceStore, events <-chan eventbus.Event, stop func()) {
+	t.Helper()
+	store = newTestStore(t)
+	addTestDevice(store, "dev", "Tail")
+	bus := eventbus.New()
+	store.OnStateChange(func(dev *Device, from, to State, reason string) {
+		bus.Publish(eventbus.DeviceStateChanged{ID: dev.ID, Name: dev.Name, From: from.String(), To: to.String(), Reason: reason})
+	})
+	events, unsubscribe := bus.Subscribe(100)
+
+	rm := NewRuntimeManager(bus, func() Link { return link }, newFakeClock())
+	rm.heartbeat = heartbeat
+	ctx, cancel := context.WithCancel(context.Background())
+	rm.Run(ctx, store)
+	return store, events, func() {
+		cancel()
+		if !rm.Wait(time.Second) {
+			t.Error("runtime did not stop")
+		}
+		unsubscribe()
+	}
+}
+
+func checkSequence(t *testing.T, got, want []string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestRuntimeEventsConnect(t *testing.T) {
+	link := &fakeLink{}
+	_, events, stop := startRuntime(t, link, heartbeatInterval)
+	checkSequence(t, eventNames(t, events, 4), []string{
+		"DeviceStateChanged Connecting", "DeviceConnecting",
+		"DeviceStateChanged Online", "DeviceConnected",
+	})
+
+	// Shutting down stops and disconnects the device
+	stop()
+	checkSequence(t, eventNames(t, events, 2), []string{
+		"DeviceStateChanged Offline", "DeviceDisconnected",
+	})
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if last := link.sent[len(link.sent)-1]; last != "0" {
+		t.Errorf("last write %q, want the stop command", last)
+	}
+}
+
+func TestRuntimeEventsConnectFailure(t *testing.T) {
+	link := &fakeLink{connect: func(string) error { return errors.New("out of range") }}
+	_, events, stop := startRuntime(t, link, heartbeatInterval)
+	defer stop()
+	checkSequence(t, eventNames(t, events, 4), []string{
+		"DeviceStateChanged Connecting", "DeviceConnecting",
+		"ConnectFailed", "DeviceStateChanged Offline",
+	})
+}
+
+func TestRuntimeEventsSendFailure(t *testing.T) {
+	link := &fakeLink{send: func(string) error { return errors.New("link lost") }}
+	_, events, stop := startRuntime(t, link, heartbeatInterval)
+	defer stop()
+	checkSequence(t, eventNames(t, events, 7), []string{
+		"DeviceStateChanged Connecting", "DeviceConnecting",
+		"DeviceStateChanged Online", "DeviceConnected",
+		"SendFailed", "DeviceStateChanged Offline", "DeviceDisconnected",
+	})
+}
+
+func TestRuntimeTimeoutsMalfunction(t *testing.T) {
+	link := &fakeLink{send: func(string) error { return blemanager.ErrSendTimeout }}
+	store, events, stop := startRuntime(t, link, time.Millisecond)
+	defer stop()
+	checkSequence(t, eventNames(t, events, 10), []string{
+		"DeviceStateChanged Connecting", "DeviceConnecting",
+		"DeviceStateChanged Online", "DeviceConnected",
+		"DeviceStateChanged Degraded", "SendFailed",
+		"SendFailed",
+		"DeviceStateChanged Malfunction", "SendFailed",
+		"DeviceDisconnected",
+	})
+	if st := store.StateOf("dev"); st != StateMalfunction {
+		t.Errorf("device is %s, want Malfunction", st)
+	}
+}
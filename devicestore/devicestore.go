@@ -5,12 +5,19 @@ import (
 	"fmt"
 	"os"
 	"sync"
-
-	"touchytails/blemanager"
-
-	"fyne.io/fyne/v2/canvas"
+	"time"
 )
 
+// Link is the connection to one device. blemanager.BLEManager is the
+// real one.
+type Link interface {
+	ConnectDevice(addr string) error
+	Send(data string) error
+	Ready() bool
+	Battery() (level float32, ok bool)
+	Disconnect()
+}
+
 // Device represents a BLE device.
 // Persistent fields are saved to JSON.
 // Runtime fields are ignored during save/load.
@@ -20,18 +27,49 @@ type Device struct {
 	Name    string `json:"name"`
 	Enabled bool   `json:"enabled"`
 	Event   string `json:"event"`
+	Group   string `json:"group,omitempty"`
+	// Position on the body map, nil until the device is placed
+	Position *Position `json:"position,omitempty"`
+	// Limits are safety caps applied in the send path
+	Limits Limits `json:"limits,omitzero"`
+	// Mapping turns OSC values into output
+	Mapping Mapping `json:"mapping,omitzero"`
+	// BHaptics is the bHaptics position the device plays, e.g. "VestFront"
+	BHaptics string `json:"bhaptics,omitempty"`
 
 	// Runtime-only
-	Online bool                   `json:"-"`
-	Status *canvas.Text           `json:"-"`
-	BLEPtr *blemanager.BLEManager `json:"-"`
+	State       State  `json:"-"`
+	StateReason string `json:"-"`
+	BLEPtr      Link   `json:"-"`
+	// Battery is the last battery level read, 0..1, valid if HasBattery
+	Battery    float32 `json:"-"`
+	HasBattery bool    `json:"-"`
+
+	writeTimeouts int // consecutive write timeouts, see RecordSendResult
+}
+
+// Position is a point on the body map in 0..1 coordinates, (0,0) being the
+// top-left corner of the silhouette
+type Position struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
 }
 
 // DeviceStore manages devices with thread safety and persistence
 type DeviceStore struct {
-	mu      sync.Mutex
-	path    string
-	devices []*Device
+	mu        sync.Mutex
+	path      string
+	devices   []*Device
+	groups    []*Group
+	settings  Settings
+	onState   StateChangeFunc
+	onSaveErr func(error)
+	saveTimer *time.Timer
+	dirty     bool            // edits not yet written to disk
+	dirtyIDs  map[string]bool // devices with unsaved edits
+	// lastWritten is the file content last saved or loaded, used by Watch
+	// to tell external edits from our own writes
+	lastWritten []byte
 }
 
 // New creates a new DeviceStore with a given path for JSON storage
@@ -39,46 +77,80 @@ func New(path string) *DeviceStore {
 	return &DeviceStore{path: path, devices: []*Device{}}
 }
 
-// Load devices from JSON file
+// Load devices from JSON file. Older file versions are migrated and saved
+// back in the current format. If the file is corrupt the newest good backup
+// is loaded and an error describing the recovery is returned.
 func (s *DeviceStore) Load() error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	data, err := os.ReadFile(s.path)
-	if err != nil {
+	cfg, migrated, restoredFrom, err := readConfig(s.path)
+	if cfg == nil {
+		s.mu.Unlock()
 		if os.IsNotExist(err) {
 			return nil // no devices yet
 		}
 		return err
 	}
-
-	if err := json.Unmarshal(data, &s.devices); err != nil {
-		return err
+	s.devices = cfg.Devices
+	s.groups = cfg.Groups
+	s.settings = cfg.Settings
+	if restoredFrom == "" {
+		s.lastWritten, _ = os.ReadFile(s.path)
+	}
+	if s.devices == nil {
+		s.devices = []*Device{}
 	}
 
 	// Initialize runtime fields
 	for _, dev := range s.devices {
-		dev.Status = nil // GUI status will be assigned later
-		dev.Online = false
 		dev.BLEPtr = nil
+		dev.State = StatePending
+		if !s.activeUnlocked(dev) {
+			dev.State = StateDisabled
+		}
 	}
+	s.mu.Unlock()
 
+	if restoredFrom != "" {
+		return fmt.Errorf("%s is unreadable (%v), restored devices from %s", s.path, err, restoredFrom)
+	}
+	if migrated {
+		return s.Save()
+	}
 	return nil
 }
 
-// Save devices to JSON file (only persistent fields)
+// Save devices to JSON file (only persistent fields). The file is replaced
+// atomically and the previous version is kept as a backup.
 func (s *DeviceStore) Save() error {
 	s.mu.Lock()
 	devicesCopy := make([]*Device, len(s.devices))
 	copy(devicesCopy, s.devices)
+	data, err := json.MarshalIndent(Profile{Version: SchemaVersion, Devices: devicesCopy, Groups: s.groups, Settings: s.settings}, "", "  ")
+	dirtyIDs := s.dirtyIDs
+	s.dirty = false
+	s.dirtyIDs = nil
 	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
-	data, err := json.MarshalIndent(devicesCopy, "", "  ")
+	err = writeConfig(s.path, data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if err != nil {
+		s.dirty = true
+		for id := range dirtyIDs {
+			s.markDirtyUnlocked(id)
+		}
 		return err
 	}
+	s.lastWritten = data
+	return nil
+}
 
-	return os.WriteFile(s.path, data, 0644)
+// Path returns the JSON file the store loads from and saves to
+func (s *DeviceStore) Path() string {
+	return s.path
 }
 
 // All returns a copy of all devices (thread-safe)
@@ -101,6 +173,7 @@ func (s *DeviceStore) Add(dev *Device) {
 		}
 	}
 	s.devices = append(s.devices, dev)
+	s.markDirtyUnlocked(dev.ID)
 }
 
 // Remove deletes a device by ID
@@ -118,8 +191,7 @@ func (s *DeviceStore) Remove(id string) {
 				d.BLEPtr.Disconnect()
 				d.BLEPtr = nil
 			}
-			d.Online = false
-			d.Status = nil
+			d.State = StateDisabled
 		}
 	}
 	s.devices = newDevices
@@ -140,6 +212,8 @@ func (s *DeviceStore) Find(id string) *Device {
 
 // Exists returns true if a device with given ID exists
 func (s *DeviceStore) Exists(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.findUnlocked(id) != nil
 }
 
@@ -164,7 +238,7 @@ func (s *DeviceStore) Count() int {
 }
 
 // --- devicestore/device_runtime_helpers.go ---
-func (s *DeviceStore) SetBLE(id string, ble *blemanager.BLEManager) {
+func (s *DeviceStore) SetBLE(id string, ble Link) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if dev := s.findUnlocked(id); dev != nil {
@@ -177,26 +251,51 @@ func (s *DeviceStore) ClearBLE(id string) {
 	defer s.mu.Unlock()
 	if dev := s.findUnlocked(id); dev != nil {
 		dev.BLEPtr = nil
+		dev.HasBattery = false
 	}
 }
 
-func (s *DeviceStore) SetOnline(id string, online bool) {
+// SetBattery records a battery level read from a device and reports
+// whether it differs from the last one
+func (s *DeviceStore) SetBattery(id string, level float32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dev := s.findUnlocked(id)
+	if dev == nil || (dev.HasBattery && dev.Battery == level) {
+		return false
+	}
+	dev.Battery, dev.HasBattery = level, true
+	return true
+}
+
+// StateOf returns the current state of a device
+func (s *DeviceStore) StateOf(id string) State {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if dev := s.findUnlocked(id); dev != nil {
-		dev.Online = online
+		return dev.State
 	}
+	return StateDisabled
 }
 
+// IsEnabled reports whether a device and its group are both enabled
 func (s *DeviceStore) IsEnabled(id string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if dev := s.findUnlocked(id); dev != nil {
-		return dev.Enabled
+		return s.activeUnlocked(dev)
 	}
 	return false
 }
 
+// markDirtyUnlocked records an unsaved edit of a device
+func (s *DeviceStore) markDirtyUnlocked(id string) {
+	if s.dirtyIDs == nil {
+		s.dirtyIDs = map[string]bool{}
+	}
+	s.dirtyIDs[id] = true
+}
+
 func (s *DeviceStore) findUnlocked(id string) *Device {
 	for _, d := range s.devices {
 		if d.ID == id {
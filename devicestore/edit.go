@@ -0,0 +1,238 @@
+// --- devicestore/edit.go ---
+package devicestore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// saveDelay is how long edits are collected before they are written out
+const saveDelay = 1 * time.Second
+
+var (
+	ErrNameEmpty    = errors.New("name must not be empty")
+	ErrNameTaken    = errors.New("name is already used by another device")
+	ErrEventInvalid = errors.New("OSC parameter may not contain spaces or any of # * , ? [ ] { }")
+)
+
+// oscReserved are characters with special meaning in OSC address patterns
+const oscReserved = " #*,?[]{}"
+
+// ValidateName checks that name is non-empty and unique among other devices
+func (s *DeviceStore) ValidateName(id, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.validateNameUnlocked(id, name)
+}
+
+func (s *DeviceStore) validateNameUnlocked(id, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrNameEmpty
+	}
+	for _, d := range s.devices {
+		if d.ID != id && strings.EqualFold(d.Name, name) {
+			return ErrNameTaken
+		}
+	}
+	return nil
+}
+
+// ValidateEvent checks that event can be used as a VRChat avatar parameter
+// name. An empty event is allowed and means "not bound".
+func ValidateEvent(event string) error {
+	if strings.ContainsAny(event, oscReserved) || strings.HasPrefix(event, "/") {
+		return ErrEventInvalid
+	}
+	for _, r := range event {
+		if r < 0x21 || r > 0x7e {
+			return ErrEventInvalid
+		}
+	}
+	return nil
+}
+
+// SetName validates and sets a device name, then schedules a save. The
+// check runs under the same lock as the rename, so two renames can't both
+// take the same free name.
+func (s *DeviceStore) SetName(id, name string) error {
+	return s.updateChecked(id, func(d *Device) error {
+		if err := s.validateNameUnlocked(id, name); err != nil {
+			return err
+		}
+		d.Name = strings.TrimSpace(name)
+		return nil
+	})
+}
+
+// SetEvent validates and sets the OSC parameter a device reacts to, then
+// schedules a save
+func (s *DeviceStore) SetEvent(id, event string) error {
+	if err := ValidateEvent(event); err != nil {
+		return err
+	}
+	return s.update(id, func(d *Device) { d.Event = event })
+}
+
+// SetPosition places a device on the body map; nil removes it from the map
+func (s *DeviceStore) SetPosition(id string, pos *Position) error {
+	if pos != nil {
+		pos = &Position{X: max(0, min(1, pos.X)), Y: max(0, min(1, pos.Y))}
+	}
+	return s.update(id, func(d *Device) { d.Position = pos })
+}
+
+// SetBHaptics sets the bHaptics position a device plays; empty unmaps it
+func (s *DeviceStore) SetBHaptics(id, position string) error {
+	return s.update(id, func(d *Device) { d.BHaptics = position })
+}
+
+// Edit changes several settings of a device at once, e.g. from the setup
+// wizard. fn edits a copy, which is checked like the single setters do and
+// stored only if every check passes.
+func (s *DeviceStore) Edit(id string, fn func(d *Device)) error {
+	err := s.updateChecked(id, func(d *Device) error {
+		edited := *d
+		fn(&edited)
+		edited.Name = strings.TrimSpace(edited.Name)
+		if err := s.validateNameUnlocked(id, edited.Name); err != nil {
+			return err
+		}
+		if err := edited.validateSettings(); err != nil {
+			return err
+		}
+		if pos := edited.Position; pos != nil {
+			edited.Position = &Position{X: max(0, min(1, pos.X)), Y: max(0, min(1, pos.Y))}
+		}
+		d.applySettings(&edited)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// fn may have changed the enabled flag or the group
+	s.syncActive([]string{id})
+	return nil
+}
+
+// update applies fn to a device under the store lock and schedules a save
+func (s *DeviceStore) update(id string, fn func(d *Device)) error {
+	return s.updateChecked(id, func(d *Device) error {
+		fn(d)
+		return nil
+	})
+}
+
+// updateChecked is update for edits that check the store first. fn runs
+// under the store lock; when it returns an error it must not have changed
+// the device, and nothing is saved.
+func (s *DeviceStore) updateChecked(id string, fn func(d *Device) error) error {
+	s.mu.Lock()
+	dev := s.findUnlocked(id)
+	if dev == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("device %s not found", id)
+	}
+	if err := fn(dev); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.markDirtyUnlocked(id)
+	s.mu.Unlock()
+
+	s.ScheduleSave()
+	return nil
+}
+
+// ScheduleSave saves the store after saveDelay. Further calls within the
+// delay restart it, so a burst of edits results in a single write.
+func (s *DeviceStore) ScheduleSave() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = true
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+	}
+	s.saveTimer = time.AfterFunc(saveDelay, func() {
+		if err := s.Flush(); err != nil && s.onSaveErr != nil {
+			s.onSaveErr(err)
+		}
+	})
+}
+
+// Flush writes pending scheduled changes immediately. Call it before exit.
+func (s *DeviceStore) Flush() error {
+	s.mu.Lock()
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	dirty := s.dirty
+	s.mu.Unlock()
+
+	if !dirty {
+		return nil
+	}
+	return s.Save()
+}
+
+// OnSaveError registers fn to report failures of scheduled saves
+func (s *DeviceStore) OnSaveError(fn func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSaveErr = fn
+}
+
+// Snapshot returns copies of all devices taken under the store lock. Use it
+// instead of reading fields through the pointers returned by All.
+func (s *DeviceStore) Snapshot() []Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Device, len(s.devices))
+	for i, d := range s.devices {
+		out[i] = *d
+	}
+	return out
+}
+
+// Get returns a copy of one device taken under the store lock
+func (s *DeviceStore) Get(id string) (Device, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dev := s.findUnlocked(id); dev != nil {
+		return *dev, true
+	}
+	return Device{}, false
+}
+
+// Lookup finds a device by ID or, failing that, by name ignoring case,
+// and returns a copy of it
+func (s *DeviceStore) Lookup(ref string) (Device, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dev := s.findUnlocked(ref); dev != nil {
+		return *dev, true
+	}
+	for _, d := range s.devices {
+		if strings.EqualFold(d.Name, strings.TrimSpace(ref)) {
+			return *d, true
+		}
+	}
+	return Device{}, false
+}
+
+// DetachBLE clears and returns the device's BLE connection, nil if it has
+// none
+func (s *DeviceStore) DetachBLE(id string) Link {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dev := s.findUnlocked(id)
+	if dev == nil {
+		return nil
+	}
+	ble := dev.BLEPtr
+	dev.BLEPtr = nil
+	return ble
+}
@@ -0,0 +1,50 @@
+package devicestore
+
+import "testing"
+
+func TestEditAppliesAllOrNothing(t *testing.T) {
+	s := newTestStore(t)
+	t.Cleanup(func() { s.Flush() })
+	addTestDevice(s, "a", "Tail")
+	addTestDevice(s, "b", "Ear")
+
+	tests := []struct {
+		name string
+		edit func(d *Device)
+	}{
+		{"name taken", func(d *Device) { d.Name = "ear"; d.Event = "Wag" }},
+		{"empty name", func(d *Device) { d.Name = " "; d.Event = "Wag" }},
+		{"invalid event", func(d *Device) { d.Name = "Big tail"; d.Event = "Two words" }},
+		{"inverted mapping", func(d *Device) {
+			d.Name = "Big tail"
+			d.Mapping = Mapping{MinIntensity: 0.8, MaxIntensity: 0.3}
+		}},
+		{"limit out of range", func(d *Device) { d.Name = "Big tail"; d.Limits.MaxDuty = 2 }},
+	}
+	for _, tt := range tests {
+		if err := s.Edit("a", tt.edit); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+		if dev, _ := s.Get("a"); dev.Name != "Tail" || dev.Event != "TailTouch" || dev.Mapping != (Mapping{}) || dev.Limits != (Limits{}) {
+			t.Errorf("%s: device changed to %+v", tt.name, dev)
+		}
+	}
+
+	err := s.Edit("a", func(d *Device) {
+		d.Name = " Big tail "
+		d.Event = "Wag"
+		d.Mapping = Mapping{MinIntensity: 0.3, MaxIntensity: 0.8}
+		d.Position = &Position{X: 2, Y: 0.5}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, _ := s.Get("a")
+	if dev.Name != "Big tail" || dev.Event != "Wag" || dev.Mapping.MaxIntensity != 0.8 || *dev.Position != (Position{X: 1, Y: 0.5}) {
+		t.Errorf("after edit %+v, position %+v", dev, *dev.Position)
+	}
+
+	if err := s.Edit("nope", func(*Device) {}); err == nil {
+		t.Error("edited a device that does not exist")
+	}
+}
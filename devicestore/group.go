@@ -0,0 +1,281 @@
+// --- devicestore/group.go ---
+package devicestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Group is a named zone of devices, e.g. "Tail" or "Left arm", that can be
+// switched, scaled and bound to an OSC parameter as a whole.
+type Group struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Intensity scales every value sent to members, 0..1
+	Intensity float32 `json:"intensity"`
+	// Event is an OSC parameter that drives all members in addition to
+	// their own Event
+	Event string `json:"event,omitempty"`
+}
+
+var ErrGroupNotFound = errors.New("group not found")
+
+// Target is a device that should receive a value for an OSC parameter,
+// together with the scale of its group
+type Target struct {
+	Device
+	Scale float32
+}
+
+// Groups returns copies of all groups sorted by name
+func (s *DeviceStore) Groups() []Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Group, len(s.groups))
+	for i, g := range s.groups {
+		out[i] = *g
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// AddGroup creates an enabled group at full intensity
+func (s *DeviceStore) AddGroup(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("group name must not be empty")
+	}
+	s.mu.Lock()
+	if s.findGroupUnlocked(name) != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("group %q already exists", name)
+	}
+	s.groups = append(s.groups, &Group{Name: name, Enabled: true, Intensity: 1})
+	s.mu.Unlock()
+
+	s.ScheduleSave()
+	return nil
+}
+
+// RemoveGroup deletes a group; its members become ungrouped
+func (s *DeviceStore) RemoveGroup(name string) {
+	var members []string
+	s.mu.Lock()
+	kept := s.groups[:0]
+	for _, g := range s.groups {
+		if g.Name != name {
+			kept = append(kept, g)
+		}
+	}
+	s.groups = kept
+	for _, d := range s.devices {
+		if d.Group == name {
+			d.Group = ""
+			s.markDirtyUnlocked(d.ID)
+			members = append(members, d.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	s.syncActive(members)
+	s.ScheduleSave()
+}
+
+// SetDeviceGroup moves a device into a group, creating the group if needed.
+// An empty name removes the device from its group.
+func (s *DeviceStore) SetDeviceGroup(id, group string) error {
+	group = strings.TrimSpace(group)
+	if group != "" {
+		s.mu.Lock()
+		exists := s.findGroupUnlocked(group) != nil
+		s.mu.Unlock()
+		if !exists {
+			if err := s.AddGroup(group); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.update(id, func(d *Device) { d.Group = group }); err != nil {
+		return err
+	}
+	s.syncActive([]string{id})
+	return nil
+}
+
+// SetGroupEnabled switches a whole group on or off. Members keep their own
+// Enabled flag, so re-enabling the group restores the previous selection.
+func (s *DeviceStore) SetGroupEnabled(name string, enabled bool) error {
+	members, err := s.updateGroup(name, func(g *Group) { g.Enabled = enabled })
+	if err != nil {
+		return err
+	}
+	s.syncActive(members)
+	return nil
+}
+
+// SetGroupIntensity sets the scale applied to every member, clamped to 0..1
+func (s *DeviceStore) SetGroupIntensity(name string, intensity float32) error {
+	intensity = max(0, min(1, intensity))
+	_, err := s.updateGroup(name, func(g *Group) { g.Intensity = intensity })
+	return err
+}
+
+// SetGroupEvent binds a whole group to an OSC parameter
+func (s *DeviceStore) SetGroupEvent(name, event string) error {
+	if err := ValidateEvent(event); err != nil {
+		return err
+	}
+	_, err := s.updateGroup(name, func(g *Group) { g.Event = event })
+	return err
+}
+
+// Targets returns the connected, active devices bound to an OSC parameter,
+// either directly or through their group
+func (s *DeviceStore) Targets(event string) []Target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Target
+	for _, d := range s.devices {
+		if !s.activeUnlocked(d) || !d.State.Connected() || d.BLEPtr == nil {
+			continue
+		}
+		scale := float32(1)
+		bound := d.Event == event
+		if g := s.findGroupUnlocked(d.Group); g != nil {
+			scale = g.Intensity
+			bound = bound || g.Event == event
+		}
+		if bound && event != "" {
+			out = append(out, Target{Device: *d, Scale: scale})
+		}
+	}
+	return out
+}
+
+// BHapticsTargets returns the connected, active devices mapped to a
+// bHaptics position, scaled by their group intensity
+func (s *DeviceStore) BHapticsTargets(position string) []Target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Target
+	for _, d := range s.devices {
+		if position == "" || d.BHaptics != position || !s.activeUnlocked(d) || !d.State.Connected() || d.BLEPtr == nil {
+			continue
+		}
+		scale := float32(1)
+		if g := s.findGroupUnlocked(d.Group); g != nil {
+			scale = g.Intensity
+		}
+		out = append(out, Target{Device: *d, Scale: scale})
+	}
+	return out
+}
+
+// GroupTargets returns the connected, active members of a group, found by
+// name ignoring case, scaled by the group intensity. ok is false if there
+// is no such group.
+func (s *DeviceStore) GroupTargets(name string) (targets []Target, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var group *Group
+	for _, g := range s.groups {
+		if strings.EqualFold(g.Name, strings.TrimSpace(name)) {
+			group = g
+		}
+	}
+	if group == nil {
+		return nil, false
+	}
+	for _, d := range s.devices {
+		if d.Group == group.Name && s.activeUnlocked(d) && d.State.Connected() && d.BLEPtr != nil {
+			targets = append(targets, Target{Device: *d, Scale: group.Intensity})
+		}
+	}
+	return targets, true
+}
+
+// updateGroup applies fn to a group and returns the IDs of its members
+func (s *DeviceStore) updateGroup(name string, fn func(g *Group)) ([]string, error) {
+	s.mu.Lock()
+	g := s.findGroupUnlocked(name)
+	if g == nil {
+		s.mu.Unlock()
+		return nil, ErrGroupNotFound
+	}
+	fn(g)
+	var members []string
+	for _, d := range s.devices {
+		if d.Group == name {
+			members = append(members, d.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	s.ScheduleSave()
+	return members, nil
+}
+
+// syncActive moves devices to Pending or Disabled after their effective
+// enabled state may have changed through a group, dropping connections of
+// devices that are no longer active
+func (s *DeviceStore) syncActive(ids []string) {
+	for _, id := range ids {
+		s.mu.Lock()
+		dev := s.findUnlocked(id)
+		if dev == nil {
+			s.mu.Unlock()
+			continue
+		}
+		active, state := s.activeUnlocked(dev), dev.State
+		var ble Link
+		if !active {
+			ble, dev.BLEPtr = dev.BLEPtr, nil
+		}
+		s.mu.Unlock()
+
+		switch {
+		case !active && state != StateDisabled:
+			if ble != nil {
+				ble.Disconnect()
+			}
+			s.Transition(id, StateDisabled, "")
+		case active && state == StateDisabled:
+			s.Transition(id, StatePending, "")
+		}
+	}
+}
+
+func (s *DeviceStore) allIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(s.devices))
+	for i, d := range s.devices {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+// activeUnlocked reports whether a device and its group are both enabled
+func (s *DeviceStore) activeUnlocked(d *Device) bool {
+	if !d.Enabled {
+		return false
+	}
+	if g := s.findGroupUnlocked(d.Group); g != nil {
+		return g.Enabled
+	}
+	return true
+}
+
+func (s *DeviceStore) findGroupUnlocked(name string) *Group {
+	if name == "" {
+		return nil
+	}
+	for _, g := range s.groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package devicestore
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// targetList prints targets as id*scale, sorted by ID
+func targetList(targets []Target) string {
+	out := make([]string, len(targets))
+	for i, tg := range targets {
+		out[i] = fmt.Sprintf("%s*%g", tg.ID, tg.Scale)
+	}
+	sort.Strings(out)
+	return fmt.Sprint(out)
+}
+
+// newGroupStore returns a store with group Back at half intensity bound to
+// BackTouch, members a and b, ungrouped c and the offline member d
+func newGroupStore(t *testing.T) (*DeviceStore, map[string]*fakeLink) {
+	t.Helper()
+	s := newTestStore(t)
+	t.Cleanup(func() { s.Flush() })
+	if err := s.AddGroup("Back"); err != nil {
+		t.Fatal(err)
+	}
+	s.SetGroupIntensity("Back", 0.5)
+	s.SetGroupEvent("Back", "BackTouch")
+	links := map[string]*fakeLink{
+		"a": addOnlineDevice(s, "a", "Left", "TailTouch", "Back"),
+		"b": addOnlineDevice(s, "b", "Right", "", "Back"),
+		"c": addOnlineDevice(s, "c", "Tail", "TailTouch", ""),
+	}
+	addTestDevice(s, "d", "Spare")
+	s.SetDeviceGroup("d", "Back")
+	return s, links
+}
+
+func TestTargetsGroupScale(t *testing.T) {
+	s, _ := newGroupStore(t)
+	tests := []struct {
+		event string
+		want  string
+	}{
+		{"TailTouch", "[a*0.5 c*1]"},
+		{"BackTouch", "[a*0.5 b*0.5]"},
+		{"", "[]"},
+		{"Nothing", "[]"},
+	}
+	for _, tt := range tests {
+		if got := targetList(s.Targets(tt.event)); got != tt.want {
+			t.Errorf("Targets(%q) = %s, want %s", tt.event, got, tt.want)
+		}
+	}
+
+	targets, ok := s.GroupTargets(" back ")
+	if !ok || targetList(targets) != "[a*0.5 b*0.5]" {
+		t.Errorf("GroupTargets = %s, %v; want a and b at half", targetList(targets), ok)
+	}
+	if _, ok := s.GroupTargets("Front"); ok {
+		t.Error("GroupTargets found a group that does not exist")
+	}
+
+	// Intensity is clamped to 0..1
+	s.SetGroupIntensity("Back", 3)
+	if got := targetList(s.Targets("BackTouch")); got != "[a*1 b*1]" {
+		t.Errorf("after intensity 3: %s, want full scale", got)
+	}
+	s.SetGroupIntensity("Back", -1)
+	if got := targetList(s.Targets("BackTouch")); got != "[a*0 b*0]" {
+		t.Errorf("after intensity -1: %s, want zero scale", got)
+	}
+}
+
+func TestGroupDisableAndReenable(t *testing.T) {
+	s, links := newGroupStore(t)
+	// b is switched off on its own and must stay off when the group returns
+	s.SetEnabled("b", false)
+
+	if err := s.SetGroupEnabled("Back", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "d"} {
+		if st := s.StateOf(id); st != StateDisabled {
+			t.Errorf("%s is %s in a disabled group, want Disabled", id, st)
+		}
+	}
+	if links["a"].Ready() {
+		t.Error("a still connected in a disabled group")
+	}
+	if dev, _ := s.Get("a"); !dev.Enabled || dev.BLEPtr != nil {
+		t.Errorf("a: enabled %v, link %v; want its own flag kept and the link dropped", dev.Enabled, dev.BLEPtr)
+	}
+	if st := s.StateOf("c"); st != StateOnline {
+		t.Errorf("ungrouped c is %s, want Online", st)
+	}
+	if got := targetList(s.Targets("BackTouch")); got != "[]" {
+		t.Errorf("disabled group still targets %s", got)
+	}
+
+	if err := s.SetGroupEnabled("Back", true); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]State{"a": StatePending, "b": StateDisabled, "c": StateOnline, "d": StatePending}
+	for id, st := range want {
+		if got := s.StateOf(id); got != st {
+			t.Errorf("%s is %s after re-enabling, want %s", id, got, st)
+		}
+	}
+}
+
+func TestGroupMembershipChangesState(t *testing.T) {
+	s, _ := newGroupStore(t)
+	s.SetGroupEnabled("Back", false)
+
+	// Joining a disabled group disables the device, leaving it enables it
+	s.SetDeviceGroup("c", "Back")
+	if st := s.StateOf("c"); st != StateDisabled {
+		t.Errorf("c is %s after joining a disabled group", st)
+	}
+	s.SetDeviceGroup("c", "")
+	if st := s.StateOf("c"); st != StatePending {
+		t.Errorf("c is %s after leaving it, want Pending", st)
+	}
+
+	// Removing the group frees its members
+	s.RemoveGroup("Back")
+	for _, id := range []string{"a", "d"} {
+		if dev, _ := s.Get(id); dev.Group != "" || dev.State != StatePending {
+			t.Errorf("%s in group %q, %s after the group was removed", id, dev.Group, dev.State)
+		}
+	}
+}
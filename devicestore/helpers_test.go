@@ -0,0 +1,108 @@
+package devicestore
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fakeLink is a Link whose connect and send results the test decides
+type fakeLink struct {
+	mu      sync.Mutex
+	connect func(addr string) error
+	send    func(data string) error
+	ready   bool
+	sent    []string
+}
+
+func (l *fakeLink) ConnectDevice(addr string) error {
+	var err error
+	if l.connect != nil {
+		err = l.connect(addr)
+	}
+	l.mu.Lock()
+	l.ready = err == nil
+	l.mu.Unlock()
+	return err
+}
+
+func (l *fakeLink) Send(data string) error {
+	l.mu.Lock()
+	l.sent = append(l.sent, data)
+	send := l.send
+	l.mu.Unlock()
+	if send != nil {
+		return send(data)
+	}
+	return nil
+}
+
+func (l *fakeLink) Ready() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ready
+}
+
+func (l *fakeLink) Battery() (float32, bool) { return 0, false }
+
+func (l *fakeLink) Disconnect() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ready = false
+}
+
+// newTestStore returns an empty store saving to a temporary directory
+func newTestStore(t *testing.T) *DeviceStore {
+	t.Helper()
+	return New(filepath.Join(t.TempDir(), "devices.json"))
+}
+
+// addTestDevice adds an enabled device in the Pending state
+func addTestDevice(s *DeviceStore, id, name string) {
+	s.Add(&Device{ID: id, Name: name, Enabled: true, Event: "TailTouch", State: StatePending})
+}
+
+// waitFor polls cond until it holds or a second passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// addOnlineDevice adds an enabled device that is online on a fake link
+func addOnlineDevice(s *DeviceStore, id, name, event, group string) *fakeLink {
+	link := &fakeLink{ready: true}
+	s.Add(&Device{ID: id, Name: name, Enabled: true, Event: event, Group: group, State: StatePending})
+	s.Transition(id, StateConnecting, "")
+	s.Transition(id, StateOnline, "")
+	s.SetBLE(id, link)
+	return link
+}
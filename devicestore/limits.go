@@ -0,0 +1,45 @@
+// --- devicestore/limits.go ---
+package devicestore
+
+import (
+	"errors"
+	"time"
+)
+
+// DutyWindow is the rolling window Limits.MaxDuty is measured over
+const DutyWindow = 60 * time.Second
+
+var ErrLimitInvalid = errors.New("limits must be between 0 and 1, on-time must not be negative")
+
+// Limits are hard caps enforced on every value sent to a device, whatever
+// OSC asks for. A zero field means "no limit".
+type Limits struct {
+	// MaxIntensity caps each value, 0..1
+	MaxIntensity float32 `json:"max_intensity,omitempty"`
+	// MaxOnSeconds is the longest the output may stay on without a break
+	MaxOnSeconds float32 `json:"max_on_seconds,omitempty"`
+	// MaxDuty is the largest fraction of DutyWindow the output may be on, 0..1
+	MaxDuty float32 `json:"max_duty,omitempty"`
+}
+
+// MaxOn returns MaxOnSeconds as a duration
+func (l Limits) MaxOn() time.Duration {
+	return time.Duration(float64(l.MaxOnSeconds) * float64(time.Second))
+}
+
+// Validate checks that every limit is in range
+func (l Limits) Validate() error {
+	if l.MaxIntensity < 0 || l.MaxIntensity > 1 || l.MaxDuty < 0 || l.MaxDuty > 1 || l.MaxOnSeconds < 0 {
+		return ErrLimitInvalid
+	}
+	return nil
+}
+
+// SetLimits validates and sets the safety limits of a device, then
+// schedules a save
+func (s *DeviceStore) SetLimits(id string, l Limits) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	return s.update(id, func(d *Device) { d.Limits = l })
+}
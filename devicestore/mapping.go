@@ -0,0 +1,63 @@
+// --- devicestore/mapping.go ---
+package devicestore
+
+import "errors"
+
+// DefaultMinIntensity is what the smallest OSC value maps to on a device
+// without a measured threshold
+const DefaultMinIntensity = 0.4
+
+var ErrMappingInvalid = errors.New("intensities must be between 0 and 1, the minimum not above the maximum")
+
+// Mapping turns OSC values into device output. Values above zero are spread
+// over Min()..Max(), so even a light touch is strong enough to be felt.
+type Mapping struct {
+	// MinIntensity is the output of the smallest value, usually the level
+	// the motor starts at. Zero means DefaultMinIntensity.
+	MinIntensity float32 `json:"min_intensity,omitempty"`
+	// MaxIntensity is the output of a full value, the strongest level that
+	// is still comfortable. Zero means full output.
+	MaxIntensity float32 `json:"max_intensity,omitempty"`
+}
+
+// Min returns the output of the smallest value
+func (m Mapping) Min() float32 {
+	if m.MinIntensity <= 0 {
+		return DefaultMinIntensity
+	}
+	return m.MinIntensity
+}
+
+// Max returns the output of a full value
+func (m Mapping) Max() float32 {
+	if m.MaxIntensity <= 0 {
+		return 1
+	}
+	return m.MaxIntensity
+}
+
+// Apply maps an OSC value to device output; zero and below stay zero
+func (m Mapping) Apply(val float32) float32 {
+	if val <= 0 {
+		return 0
+	}
+	low := m.Min()
+	return low + min(val, 1)*(m.Max()-low)
+}
+
+// Validate checks that the mapping is in range
+func (m Mapping) Validate() error {
+	if m.MinIntensity < 0 || m.MinIntensity > 1 || m.MaxIntensity < 0 || m.MaxIntensity > 1 || m.Min() > m.Max() {
+		return ErrMappingInvalid
+	}
+	return nil
+}
+
+// SetMapping validates and sets how OSC values map to output on a device,
+// then schedules a save
+func (s *DeviceStore) SetMapping(id string, m Mapping) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	return s.update(id, func(d *Device) { d.Mapping = m })
+}
@@ -0,0 +1,186 @@
+// --- devicestore/persist.go ---
+package devicestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SchemaVersion is the config file version written by Save
+const SchemaVersion = 2
+
+// backupCount is how many previous good files are kept as path.bak.1..N
+const backupCount = 3
+
+// Profile is the on-disk configuration layout. devices.json and exported
+// profiles share it, so old exports are migrated the same way on import.
+type Profile struct {
+	Version  int       `json:"version"`
+	Devices  []*Device `json:"devices"`
+	Groups   []*Group  `json:"groups,omitempty"`
+	Settings Settings  `json:"settings,omitzero"`
+}
+
+// migration upgrades a decoded document from version from to from+1
+type migration struct {
+	from    int
+	migrate func(doc map[string]any) error
+}
+
+// migrations run in order until the document reaches SchemaVersion.
+// Add new entries at the end; never change old ones.
+var migrations = []migration{
+	{from: 1, migrate: migrateV1ToV2},
+}
+
+// Version 1 was a bare JSON array of devices
+func migrateV1ToV2(doc map[string]any) error {
+	if _, ok := doc["devices"]; !ok {
+		doc["devices"] = []any{}
+	}
+	return nil
+}
+
+// decodeConfig parses data of any known version and upgrades it.
+// It reports whether a migration was applied.
+func decodeConfig(data []byte) (*Profile, bool, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, err
+	}
+
+	var doc map[string]any
+	switch v := raw.(type) {
+	case []any:
+		doc = map[string]any{"version": float64(1), "devices": v}
+	case map[string]any:
+		doc = v
+	default:
+		return nil, false, errors.New("unexpected config format")
+	}
+
+	version := 1
+	if v, ok := doc["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > SchemaVersion {
+		return nil, false, fmt.Errorf("config version %d is newer than supported version %d", version, SchemaVersion)
+	}
+
+	migrated := false
+	for _, m := range migrations {
+		if m.from != version {
+			continue
+		}
+		if err := m.migrate(doc); err != nil {
+			return nil, false, fmt.Errorf("migrate config from version %d: %w", version, err)
+		}
+		version++
+		doc["version"] = float64(version)
+		migrated = true
+	}
+	if version != SchemaVersion {
+		return nil, false, fmt.Errorf("no migration from config version %d", version)
+	}
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	var cfg Profile
+	if err := json.Unmarshal(upgraded, &cfg); err != nil {
+		return nil, false, err
+	}
+	return &cfg, migrated, nil
+}
+
+// readConfig loads path, falling back to the newest readable backup when the
+// main file is corrupt. restoredFrom names the backup used, if any.
+func readConfig(path string) (cfg *Profile, migrated bool, restoredFrom string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, "", err
+	}
+	cfg, migrated, err = decodeConfig(data)
+	if err == nil {
+		return cfg, migrated, "", nil
+	}
+
+	for i := 1; i <= backupCount; i++ {
+		backup := backupPath(path, i)
+		data, readErr := os.ReadFile(backup)
+		if readErr != nil {
+			continue
+		}
+		if bcfg, bmigrated, decErr := decodeConfig(data); decErr == nil {
+			return bcfg, bmigrated, backup, err
+		}
+	}
+	return nil, false, "", err
+}
+
+// writeConfig atomically replaces path with data. The previous file is kept
+// as the first backup and older backups are shifted up.
+func writeConfig(path string, data []byte) error {
+	old, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if string(old) == string(data) {
+			return nil // nothing changed
+		}
+		if _, _, decErr := decodeConfig(old); decErr == nil {
+			if err := rotateBackups(path, old); err != nil {
+				return err
+			}
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+func rotateBackups(path string, current []byte) error {
+	for i := backupCount - 1; i >= 1; i-- {
+		from := backupPath(path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, backupPath(path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return writeFileAtomic(backupPath(path, 1), current, 0644)
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// writeFileAtomic writes to a temp file in the same directory, syncs it and
+// renames it over path, so readers see either the old or the new file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
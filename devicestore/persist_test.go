@@ -0,0 +1,193 @@
+package devicestore
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const v1Config = `[{"id":"aa","name":"Tail","enabled":true,"event":"TailTouch"}]`
+
+// v2Config returns a current config file with one device named name
+func v2Config(name string) string {
+	return `{"version":2,"devices":[{"id":"aa","name":"` + name + `","enabled":true,"event":"TailTouch"}]}`
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDecodeConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		devices  int
+		migrated bool
+		wantErr  bool
+	}{
+		{"v1 bare array", v1Config, 1, true, false},
+		{"v1 empty array", `[]`, 0, true, false},
+		{"object without version", `{"devices":[{"id":"aa"}]}`, 1, true, false},
+		{"v1 object without devices", `{"version":1}`, 0, true, false},
+		{"v2", v2Config("Tail"), 1, false, false},
+		{"newer version", `{"version":99,"devices":[]}`, 0, false, true},
+		{"truncated", v2Config("Tail")[:30], 0, false, true},
+		{"not a document", `"devices"`, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, migrated, err := decodeConfig([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.Version != SchemaVersion {
+				t.Errorf("version %d, want %d", cfg.Version, SchemaVersion)
+			}
+			if len(cfg.Devices) != tt.devices || migrated != tt.migrated {
+				t.Errorf("%d devices, migrated %v; want %d, %v", len(cfg.Devices), migrated, tt.devices, tt.migrated)
+			}
+		})
+	}
+}
+
+func TestLoadMigratesV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	writeFile(t, path, v1Config)
+
+	s := New(path)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	dev, ok := s.Get("aa")
+	if !ok || dev.Name != "Tail" || dev.Event != "TailTouch" || !dev.Enabled {
+		t.Fatalf("loaded %+v, want the v1 device", dev)
+	}
+
+	// The upgraded file is saved right away and the v1 file kept as backup
+	var saved Profile
+	if err := json.Unmarshal([]byte(readFile(t, path)), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != SchemaVersion || len(saved.Devices) != 1 {
+		t.Errorf("saved version %d with %d devices", saved.Version, len(saved.Devices))
+	}
+	if got := readFile(t, backupPath(path, 1)); got != v1Config {
+		t.Errorf("backup %q, want the v1 file", got)
+	}
+}
+
+func TestLoadTruncatedWithoutBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	writeFile(t, path, v2Config("Tail")[:30])
+
+	s := New(path)
+	if err := s.Load(); err == nil {
+		t.Fatal("loaded a truncated file without error")
+	}
+	if s.Count() != 0 {
+		t.Errorf("%d devices loaded from a truncated file", s.Count())
+	}
+}
+
+func TestLoadRestoresNewestGoodBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	corrupt := "{not json"
+	writeFile(t, path, corrupt)
+	writeFile(t, backupPath(path, 1), v2Config("Tail")[:30])
+	writeFile(t, backupPath(path, 2), v2Config("Second"))
+	writeFile(t, backupPath(path, 3), v2Config("Third"))
+
+	s := New(path)
+	err := s.Load()
+	if err == nil || !strings.Contains(err.Error(), backupPath(path, 2)) {
+		t.Fatalf("err = %v, want a note about restoring from .bak.2", err)
+	}
+	if dev, _ := s.Get("aa"); dev.Name != "Second" {
+		t.Errorf("restored %q, want the device from .bak.2", dev.Name)
+	}
+
+	// Saving replaces the corrupt file without rotating it into the backups
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodeConfig([]byte(readFile(t, path))); err != nil {
+		t.Errorf("saved file unreadable: %v", err)
+	}
+	if got := readFile(t, backupPath(path, 1)); got != v2Config("Tail")[:30] {
+		t.Errorf(".bak.1 changed to %q", got)
+	}
+}
+
+func TestWriteConfigRotatesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devices.json")
+	versions := []string{v2Config("A"), v2Config("B"), v2Config("C"), v2Config("D"), v2Config("E")}
+	for _, v := range versions {
+		if err := writeConfig(path, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Writing the same content again must not push out a backup
+	if err := writeConfig(path, []byte(versions[4])); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, path); got != versions[4] {
+		t.Errorf("file %q, want the last write", got)
+	}
+	for i := 1; i <= backupCount; i++ {
+		if got, want := readFile(t, backupPath(path, i)), versions[4-i]; got != want {
+			t.Errorf(".bak.%d is %q, want %q", i, got, want)
+		}
+	}
+	if _, err := os.Stat(backupPath(path, backupCount+1)); !os.IsNotExist(err) {
+		t.Errorf("kept more than %d backups", backupCount)
+	}
+
+	// The atomic write leaves no temp files behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temp file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestWriteConfigSkipsCorruptBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	writeFile(t, path, v2Config("Good"))
+	if err := writeConfig(path, []byte(v2Config("New"))); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "{broken")
+	if err := writeConfig(path, []byte(v2Config("Newer"))); err != nil {
+		t.Fatal(err)
+	}
+	// A corrupt file is never kept as a backup
+	if got := readFile(t, backupPath(path, 1)); got != v2Config("Good") {
+		t.Errorf(".bak.1 is %q, want the last good file", got)
+	}
+	if _, err := os.Stat(backupPath(path, 2)); !os.IsNotExist(err) {
+		t.Error("the corrupt file was rotated into the backups")
+	}
+}
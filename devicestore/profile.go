@@ -0,0 +1,225 @@
+// --- devicestore/profile.go ---
+package devicestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConflictPolicy decides what Import does with devices that already exist
+type ConflictPolicy int
+
+const (
+	KeepExisting    ConflictPolicy = iota // leave existing devices untouched
+	ReplaceExisting                       // overwrite their settings from the profile
+)
+
+// ImportOptions controls how a profile is merged into the store
+type ImportOptions struct {
+	Conflict ConflictPolicy
+	// Remap maps device IDs in the profile to local BLE addresses, so a
+	// profile made on one PC can be applied to different physical devices.
+	// Remapped devices always take the profile's settings; Conflict only
+	// applies to the others.
+	Remap map[string]string
+}
+
+// ImportResult lists the device IDs (after remapping) Import touched
+type ImportResult struct {
+	Added   []string
+	Updated []string
+	Skipped []string
+	// Renamed are devices whose profile name was empty or already taken
+	Renamed []string
+	// Invalid explains the devices and groups left out because their
+	// settings are out of range
+	Invalid []error
+}
+
+func (r ImportResult) String() string {
+	s := fmt.Sprintf("%d added, %d updated, %d skipped", len(r.Added), len(r.Updated), len(r.Skipped))
+	if len(r.Renamed) > 0 {
+		s += fmt.Sprintf(", %d renamed", len(r.Renamed))
+	}
+	if len(r.Invalid) > 0 {
+		s += fmt.Sprintf(", %d invalid", len(r.Invalid))
+	}
+	return s
+}
+
+// ExportProfile returns the persistent configuration as a profile file
+func (s *DeviceStore) ExportProfile() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.MarshalIndent(Profile{Version: SchemaVersion, Devices: s.devices, Groups: s.groups}, "", "  ")
+}
+
+// DecodeProfile parses an exported profile, migrating older versions
+func DecodeProfile(data []byte) (*Profile, error) {
+	p, _, err := decodeConfig(data)
+	return p, err
+}
+
+// Unmatched returns the profile devices whose IDs are unknown to this store.
+// These are candidates for remapping to local hardware.
+func (s *DeviceStore) Unmatched(p *Profile) []*Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Device
+	for _, d := range p.Devices {
+		if s.findUnlocked(d.ID) == nil {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Conflicts returns the IDs that exist both in the profile and in the
+// store. Remapped devices are left out, they were picked to be replaced.
+func (s *DeviceStore) Conflicts(p *Profile, remap map[string]string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, d := range p.Devices {
+		if remapID(d.ID, remap) == d.ID && s.findUnlocked(d.ID) != nil {
+			out = append(out, d.ID)
+		}
+	}
+	return out
+}
+
+// Import merges a profile into the store by device ID. Runtime state of
+// existing devices, such as open connections, is kept.
+func (s *DeviceStore) Import(p *Profile, opts ImportOptions) ImportResult {
+	var res ImportResult
+
+	s.mu.Lock()
+	for _, src := range p.Groups {
+		checked, err := src.checked()
+		if err != nil {
+			res.Invalid = append(res.Invalid, fmt.Errorf("group %q: %w", src.Name, err))
+			continue
+		}
+		if g := s.findGroupUnlocked(checked.Name); g == nil {
+			s.groups = append(s.groups, &checked)
+		} else if opts.Conflict == ReplaceExisting {
+			*g = checked
+		}
+	}
+	for _, src := range p.Devices {
+		id := remapID(src.ID, opts.Remap)
+		remapped := id != src.ID
+		if err := src.validateSettings(); err != nil {
+			res.Invalid = append(res.Invalid, fmt.Errorf("device %s: %w", src.ID, err))
+			continue
+		}
+		if dev := s.findUnlocked(id); dev != nil {
+			if !remapped && opts.Conflict != ReplaceExisting {
+				res.Skipped = append(res.Skipped, id)
+				continue
+			}
+			name := s.importNameUnlocked(id, src.Name, dev.Name)
+			dev.applySettings(src)
+			if dev.Name != name {
+				dev.Name = name
+				res.Renamed = append(res.Renamed, id)
+			}
+			s.markDirtyUnlocked(id)
+			res.Updated = append(res.Updated, id)
+			continue
+		}
+
+		dev := &Device{ID: id}
+		name := s.importNameUnlocked(id, src.Name, id)
+		dev.applySettings(src)
+		if dev.Name != name {
+			dev.Name = name
+			res.Renamed = append(res.Renamed, id)
+		}
+		dev.State = StatePending
+		if !s.activeUnlocked(dev) {
+			dev.State = StateDisabled
+		}
+		s.devices = append(s.devices, dev)
+		s.markDirtyUnlocked(id)
+		res.Added = append(res.Added, id)
+	}
+	s.mu.Unlock()
+
+	// Keep the state machine in line with the imported enabled flags
+	s.syncActive(s.allIDs())
+	return res
+}
+
+// validateSettings runs the checks the setters apply to app edits on
+// settings read from a file, which may have been edited by hand
+func (d *Device) validateSettings() error {
+	if strings.TrimSpace(d.ID) == "" {
+		return errors.New("device ID must not be empty")
+	}
+	if err := ValidateEvent(d.Event); err != nil {
+		return err
+	}
+	if err := d.Limits.Validate(); err != nil {
+		return err
+	}
+	return d.Mapping.Validate()
+}
+
+// checked returns a copy of a group read from a file with its intensity
+// clamped to 0..1, or an error if its name or event is invalid
+func (g *Group) checked() (Group, error) {
+	out := *g
+	out.Name = strings.TrimSpace(out.Name)
+	if out.Name == "" {
+		return out, errors.New("group name must not be empty")
+	}
+	if err := ValidateEvent(out.Event); err != nil {
+		return out, err
+	}
+	out.Intensity = max(0, min(1, out.Intensity))
+	return out, nil
+}
+
+// applySettings copies the persistent settings of src, except the ID
+func (d *Device) applySettings(src *Device) {
+	d.Name = src.Name
+	d.Enabled = src.Enabled
+	d.Event = src.Event
+	d.Group = src.Group
+	d.Limits = src.Limits
+	d.Mapping = src.Mapping
+	d.BHaptics = src.BHaptics
+	d.Position = nil
+	if src.Position != nil {
+		pos := *src.Position
+		d.Position = &pos
+	}
+}
+
+// importNameUnlocked returns a valid name for an imported device: the
+// profile's name, or fallback if that is empty, numbered if another
+// device already has it
+func (s *DeviceStore) importNameUnlocked(id, name, fallback string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = fallback
+	}
+	if s.validateNameUnlocked(id, name) == nil {
+		return name
+	}
+	for n := 2; ; n++ {
+		if numbered := fmt.Sprintf("%s (%d)", name, n); s.validateNameUnlocked(id, numbered) == nil {
+			return numbered
+		}
+	}
+}
+
+func remapID(id string, remap map[string]string) string {
+	if to, ok := remap[id]; ok && to != "" {
+		return to
+	}
+	return id
+}
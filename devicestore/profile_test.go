@@ -0,0 +1,96 @@
+package devicestore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestImportRemap(t *testing.T) {
+	s := newTestStore(t)
+	addTestDevice(s, "local", "Board")
+	addTestDevice(s, "shared", "Ear")
+
+	p := &Profile{Devices: []*Device{
+		{ID: "remote", Name: "Tail", Enabled: true, Event: "TailTouch"},
+		{ID: "shared", Name: "Left ear", Enabled: true, Event: "EarTouch"},
+	}}
+	remap := map[string]string{"remote": "local"}
+
+	// The remap target is not a conflict, only the device both have is
+	if got := fmt.Sprint(s.Conflicts(p, remap)); got != "[shared]" {
+		t.Errorf("conflicts %s, want [shared]", got)
+	}
+
+	res := s.Import(p, ImportOptions{Conflict: KeepExisting, Remap: remap})
+	if fmt.Sprint(res.Updated, res.Skipped, res.Added) != "[local] [shared] []" {
+		t.Errorf("updated %v, skipped %v, added %v", res.Updated, res.Skipped, res.Added)
+	}
+	if dev, _ := s.Get("local"); dev.Name != "Tail" || dev.Event != "TailTouch" {
+		t.Errorf("remapped device is %q on %q, want Tail on TailTouch", dev.Name, dev.Event)
+	}
+	if dev, _ := s.Get("shared"); dev.Name != "Ear" {
+		t.Errorf("kept device renamed to %q", dev.Name)
+	}
+}
+
+func TestImportNames(t *testing.T) {
+	s := newTestStore(t)
+	addTestDevice(s, "a", "Tail")
+
+	p := &Profile{Devices: []*Device{
+		{ID: "b", Name: "tail", Enabled: true},
+		{ID: "c", Name: "Tail", Enabled: true},
+		{ID: "d", Name: "  ", Enabled: true},
+	}}
+	res := s.Import(p, ImportOptions{})
+	want := map[string]string{"b": "tail (2)", "c": "Tail (3)", "d": "d"}
+	for id, name := range want {
+		if dev, _ := s.Get(id); dev.Name != name {
+			t.Errorf("%s named %q, want %q", id, dev.Name, name)
+		}
+	}
+	if len(res.Renamed) != 3 {
+		t.Errorf("renamed %v, want all three", res.Renamed)
+	}
+}
+
+func TestImportRejectsInvalidSettings(t *testing.T) {
+	s := newTestStore(t)
+	addTestDevice(s, "a", "Tail")
+	s.SetLimits("a", Limits{MaxIntensity: 0.5})
+
+	p := &Profile{
+		Devices: []*Device{
+			{ID: "a", Name: "Tail", Enabled: true, Limits: Limits{MaxIntensity: 2}},
+			{ID: "b", Name: "Ear", Event: "/avatar/parameters/Ear"},
+			{ID: "c", Name: "Paw", Mapping: Mapping{MinIntensity: 0.9, MaxIntensity: 0.5}},
+			{ID: "d", Name: "Nose", Limits: Limits{MaxOnSeconds: -1}},
+			{ID: "e", Name: "Back", Limits: Limits{MaxDuty: 0.5}},
+		},
+		Groups: []*Group{
+			{Name: " ", Enabled: true},
+			{Name: "Loud", Enabled: true, Intensity: 5},
+			{Name: "Bad", Event: "Two words"},
+		},
+	}
+	res := s.Import(p, ImportOptions{Conflict: ReplaceExisting})
+
+	if len(res.Invalid) != 6 {
+		t.Errorf("%d invalid entries, want 6: %v", len(res.Invalid), res.Invalid)
+	}
+	if fmt.Sprint(res.Added, res.Updated) != "[e] []" {
+		t.Errorf("added %v, updated %v; want only e added", res.Added, res.Updated)
+	}
+	if dev, _ := s.Get("a"); dev.Limits.MaxIntensity != 0.5 {
+		t.Errorf("invalid import replaced the limits of a: %+v", dev.Limits)
+	}
+	for _, id := range []string{"b", "c", "d"} {
+		if s.Exists(id) {
+			t.Errorf("invalid device %s imported", id)
+		}
+	}
+	groups := s.Groups()
+	if len(groups) != 1 || groups[0].Name != "Loud" || groups[0].Intensity != 1 {
+		t.Errorf("groups %+v, want only Loud clamped to full intensity", groups)
+	}
+}
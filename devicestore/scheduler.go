@@ -0,0 +1,142 @@
+// --- devicestore/scheduler.go ---
+package devicestore
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	backoffBase   = 2 * time.Second  // delay after the first failed attempt
+	backoffMax    = 2 * time.Minute  // upper bound for the exponential delay
+	backoffJitter = 0.2              // +/- fraction applied to every delay
+	seenWindow    = 30 * time.Second // how long a scan sighting counts as "recent"
+	seenRetry     = 1 * time.Second  // retry delay for recently seen devices
+)
+
+// Clock tells the scheduler and runtime the time, so tests can move it
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// ConnectScheduler decides when a device may try to connect again and limits
+// how many connection attempts run at the same time. Many BLE stacks behave
+// badly with several concurrent connects, so attempts queue for a slot.
+type ConnectScheduler struct {
+	mu       sync.Mutex
+	clock    Clock
+	random   func() float64 // 0..1, drives the jitter
+	slots    chan struct{}
+	backoffs map[string]*backoffState
+	seen     map[string]time.Time
+}
+
+type backoffState struct {
+	failures int
+	next     time.Time
+}
+
+// NewConnectScheduler creates a scheduler allowing maxConcurrent attempts
+// at once, timing backoffs with clock
+func NewConnectScheduler(maxConcurrent int, clock Clock) *ConnectScheduler {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &ConnectScheduler{
+		clock:    clock,
+		random:   rand.Float64,
+		slots:    make(chan struct{}, maxConcurrent),
+		backoffs: make(map[string]*backoffState),
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// Due reports whether the device's backoff delay has elapsed
+func (s *ConnectScheduler) Due(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.backoffs[id]
+	return !ok || !s.clock.Now().Before(st.next)
+}
+
+// Acquire blocks until a connection slot is free. It returns false if ctx
+// is cancelled first, in which case no slot is held.
+func (s *ConnectScheduler) Acquire(ctx context.Context) bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (s *ConnectScheduler) Release() {
+	<-s.slots
+}
+
+// Failure records a failed attempt and returns the delay before the next one
+func (s *ConnectScheduler) Failure(id string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.backoffs[id]
+	if !ok {
+		st = &backoffState{}
+		s.backoffs[id] = st
+	}
+	st.failures++
+
+	delay := backoffBase
+	for i := 1; i < st.failures && delay < backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > backoffMax {
+		delay = backoffMax
+	}
+	if s.recentlySeenUnlocked(id) && delay > seenRetry {
+		delay = seenRetry
+	}
+	delay = withJitter(delay, s.random())
+
+	st.next = s.clock.Now().Add(delay)
+	return delay
+}
+
+// Success clears the backoff state after a successful connection
+func (s *ConnectScheduler) Success(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.backoffs, id)
+}
+
+// MarkSeen records that the device showed up in a scan. A device that is
+// advertising is likely reachable, so its pending backoff is cut short.
+func (s *ConnectScheduler) MarkSeen(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	s.seen[id] = now
+	if st, ok := s.backoffs[id]; ok {
+		st.next = now
+	}
+}
+
+func (s *ConnectScheduler) recentlySeenUnlocked(id string) bool {
+	t, ok := s.seen[id]
+	return ok && s.clock.Now().Sub(t) < seenWindow
+}
+
+// withJitter spreads retries so devices don't reconnect in lockstep; r is
+// a random number in 0..1
+func withJitter(d time.Duration, r float64) time.Duration {
+	f := 1 + backoffJitter*(2*r-1)
+	return time.Duration(float64(d) * f)
+}
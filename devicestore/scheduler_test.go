@@ -0,0 +1,135 @@
+package devicestore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestScheduler returns a scheduler on a fake clock with no jitter
+func newTestScheduler(maxConcurrent int) (*ConnectScheduler, *fakeClock) {
+	clock := newFakeClock()
+	s := NewConnectScheduler(maxConcurrent, clock)
+	s.random = func() float64 { return 0.5 }
+	return s, clock
+}
+
+func TestBackoffGrows(t *testing.T) {
+	s, _ := newTestScheduler(1)
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second}
+	for i, w := range want {
+		if got := s.Failure("a"); got != w {
+			t.Errorf("failure %d: delay %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestBackoffCap(t *testing.T) {
+	s, _ := newTestScheduler(1)
+	var got time.Duration
+	for range 20 {
+		got = s.Failure("a")
+	}
+	if got != backoffMax {
+		t.Errorf("delay after 20 failures %v, want %v", got, backoffMax)
+	}
+}
+
+func TestBackoffDue(t *testing.T) {
+	s, clock := newTestScheduler(1)
+	if !s.Due("a") {
+		t.Fatal("device without failures is not due")
+	}
+	delay := s.Failure("a")
+	if s.Due("a") {
+		t.Error("due right after a failure")
+	}
+	clock.Advance(delay - time.Millisecond)
+	if s.Due("a") {
+		t.Error("due before the delay passed")
+	}
+	clock.Advance(time.Millisecond)
+	if !s.Due("a") {
+		t.Error("not due once the delay passed")
+	}
+
+	s.Failure("a")
+	s.Success("a")
+	if !s.Due("a") {
+		t.Error("not due after Success")
+	}
+	if got := s.Failure("a"); got != backoffBase {
+		t.Errorf("delay after Success %v, want %v", got, backoffBase)
+	}
+}
+
+func TestBackoffJitterBounds(t *testing.T) {
+	tests := []struct {
+		r    float64
+		want time.Duration
+	}{
+		{0, 1600 * time.Millisecond},
+		{0.5, 2 * time.Second},
+		{1, 2400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := withJitter(2*time.Second, tt.r); got != tt.want {
+			t.Errorf("withJitter(2s, %v) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+
+	// With real randomness every delay stays within +/- backoffJitter
+	s := NewConnectScheduler(1, newFakeClock())
+	low := time.Duration(float64(backoffBase) * (1 - backoffJitter))
+	high := time.Duration(float64(backoffBase) * (1 + backoffJitter))
+	for range 1000 {
+		s.Success("a")
+		if got := s.Failure("a"); got < low || got > high {
+			t.Fatalf("delay %v outside %v..%v", got, low, high)
+		}
+	}
+}
+
+func TestMarkSeen(t *testing.T) {
+	s, clock := newTestScheduler(1)
+	for range 5 {
+		s.Failure("a")
+	}
+	if s.Due("a") {
+		t.Fatal("due right after failures")
+	}
+
+	// A sighting ends the pending backoff at once
+	s.MarkSeen("a")
+	if !s.Due("a") {
+		t.Error("not due after MarkSeen")
+	}
+
+	// and keeps later retries short while it is recent
+	if got := s.Failure("a"); got != seenRetry {
+		t.Errorf("delay while recently seen %v, want %v", got, seenRetry)
+	}
+	clock.Advance(seenWindow)
+	if got := s.Failure("a"); got != backoffMax {
+		t.Errorf("delay once the sighting is old %v, want %v", got, backoffMax)
+	}
+}
+
+func TestAcquireLimit(t *testing.T) {
+	s, _ := newTestScheduler(2)
+	ctx := context.Background()
+	if !s.Acquire(ctx) || !s.Acquire(ctx) {
+		t.Fatal("could not take the free slots")
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if s.Acquire(short) {
+		t.Fatal("took a third slot")
+	}
+
+	s.Release()
+	if !s.Acquire(ctx) {
+		t.Error("slot not free after Release")
+	}
+}
@@ -0,0 +1,67 @@
+// --- devicestore/settings.go ---
+package devicestore
+
+import "errors"
+
+var ErrSettingsInvalid = errors.New("ports must be between 0 and 65535, the status prefix only letters, digits and _")
+
+// Settings are app-wide preferences stored next to the devices. They are
+// left out of exported profiles.
+type Settings struct {
+	// StartMinimized starts the app in the system tray without a window
+	StartMinimized bool `json:"start_minimized,omitempty"`
+	// QuitOnClose quits when the window closes instead of hiding to the tray
+	QuitOnClose bool `json:"quit_on_close,omitempty"`
+
+	// APIEnabled turns on the local HTTP control API
+	APIEnabled bool `json:"api_enabled,omitempty"`
+	// APIPort is the port of the local API, the app default when zero
+	APIPort int `json:"api_port,omitempty"`
+	// APIToken is the secret API clients must send
+	APIToken string `json:"api_token,omitempty"`
+
+	// StatusOSC sends device status to VRChat as avatar parameters
+	StatusOSC bool `json:"status_osc,omitempty"`
+	// StatusPort is the port VRChat listens on, the app default when zero
+	StatusPort int `json:"status_port,omitempty"`
+	// StatusPrefix starts every status parameter name, the app default
+	// when empty
+	StatusPrefix string `json:"status_prefix,omitempty"`
+
+	// BHapticsEnabled runs the bHaptics bridge
+	BHapticsEnabled bool `json:"bhaptics_enabled,omitempty"`
+	// BHapticsPort is the port of the bHaptics bridge, the bHaptics
+	// Player port when zero
+	BHapticsPort int `json:"bhaptics_port,omitempty"`
+}
+
+// Validate checks settings read from a file, which may have been edited by
+// hand. Zero ports and an empty prefix mean the app defaults.
+func (st Settings) Validate() error {
+	for _, port := range []int{st.APIPort, st.StatusPort, st.BHapticsPort} {
+		if port < 0 || port > 65535 {
+			return ErrSettingsInvalid
+		}
+	}
+	for _, r := range st.StatusPrefix {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return ErrSettingsInvalid
+		}
+	}
+	return nil
+}
+
+// Settings returns a copy of the app settings
+func (s *DeviceStore) Settings() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings
+}
+
+// UpdateSettings applies fn to the app settings and schedules a save
+func (s *DeviceStore) UpdateSettings(fn func(st *Settings)) {
+	s.mu.Lock()
+	fn(&s.settings)
+	s.mu.Unlock()
+	s.ScheduleSave()
+}
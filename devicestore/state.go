@@ -0,0 +1,163 @@
+// --- devicestore/state.go ---
+package devicestore
+
+import (
+	"errors"
+	"fmt"
+
+	"touchytails/blemanager"
+)
+
+// State is the lifecycle state of a device
+type State int
+
+const (
+	StatePending     State = iota // enabled, waiting for the first attempt
+	StateDisabled                 // switched off by the user
+	StateConnecting               // connection attempt in progress
+	StateOnline                   // connected and accepting data
+	StateDegraded                 // connected, but recent writes failed
+	StateMalfunction              // repeated write timeouts or incompatible firmware
+	StateOffline                  // enabled but not reachable
+)
+
+// malfunctionTimeouts is how many consecutive write timeouts mark a device
+// as malfunctioning rather than degraded.
+const malfunctionTimeouts = 3
+
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+var stateNames = map[State]string{
+	StatePending:     "Pending",
+	StateDisabled:    "Disabled",
+	StateConnecting:  "Connecting",
+	StateOnline:      "Online",
+	StateDegraded:    "Degraded",
+	StateMalfunction: "Malfunction",
+	StateOffline:     "Offline",
+}
+
+// transitions lists the states reachable from each state. Every state may
+// also move to Disabled, and staying in the same state is always allowed.
+var transitions = map[State][]State{
+	StatePending:     {StateConnecting, StateOffline},
+	StateDisabled:    {StatePending},
+	StateConnecting:  {StateOnline, StateOffline, StateMalfunction},
+	StateOnline:      {StateDegraded, StateMalfunction, StateOffline},
+	StateDegraded:    {StateOnline, StateMalfunction, StateOffline},
+	StateMalfunction: {StateConnecting},
+	StateOffline:     {StateConnecting},
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Connected reports whether the device can receive data in this state
+func (s State) Connected() bool {
+	return s == StateOnline || s == StateDegraded
+}
+
+// CanTransition reports whether moving from s to next is allowed
+func (s State) CanTransition(next State) bool {
+	if s == next || (next == StateDisabled && s != StateDisabled) {
+		return true
+	}
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// StateChangeFunc is called after every successful state change with a
+// copy of the device taken at the time of the change
+type StateChangeFunc func(dev *Device, from, to State, reason string)
+
+// OnStateChange registers fn to be called after each state change
+func (s *DeviceStore) OnStateChange(fn StateChangeFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onState = fn
+}
+
+// Transition moves a device to a new state, rejecting transitions the state
+// machine does not allow. Reason explains the change, e.g. an error text.
+func (s *DeviceStore) Transition(id string, to State, reason string) error {
+	s.mu.Lock()
+	dev := s.findUnlocked(id)
+	if dev == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("device %s not found", id)
+	}
+	from := dev.State
+	if !from.CanTransition(to) {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	dev.State = to
+	dev.StateReason = reason
+	snap := *dev
+	onState := s.onState
+	s.mu.Unlock()
+
+	if from != to && onState != nil {
+		onState(&snap, from, to, reason)
+	}
+	return nil
+}
+
+// SetEnabled switches a device on or off and moves it to Pending or
+// Disabled. A device in a disabled group stays Disabled.
+func (s *DeviceStore) SetEnabled(id string, enabled bool) error {
+	s.mu.Lock()
+	dev := s.findUnlocked(id)
+	if dev == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("device %s not found", id)
+	}
+	dev.Enabled = enabled
+	s.markDirtyUnlocked(id)
+	s.mu.Unlock()
+
+	s.syncActive([]string{id})
+	return nil
+}
+
+// RecordSendResult updates the write timeout counter after a send. A single
+// timeout degrades the device; malfunctionTimeouts in a row mark it as
+// malfunctioning. A successful write restores a degraded device.
+func (s *DeviceStore) RecordSendResult(id string, err error) {
+	s.mu.Lock()
+	dev := s.findUnlocked(id)
+	if dev == nil {
+		s.mu.Unlock()
+		return
+	}
+	state := dev.State
+	if err == nil {
+		dev.writeTimeouts = 0
+		s.mu.Unlock()
+		if state == StateDegraded {
+			s.Transition(id, StateOnline, "writes recovered")
+		}
+		return
+	}
+	if !errors.Is(err, blemanager.ErrSendTimeout) {
+		s.mu.Unlock()
+		return
+	}
+	dev.writeTimeouts++
+	timeouts := dev.writeTimeouts
+	s.mu.Unlock()
+
+	if timeouts >= malfunctionTimeouts {
+		s.Transition(id, StateMalfunction, fmt.Sprintf("%d write timeouts in a row", timeouts))
+	} else if state.Connected() {
+		s.Transition(id, StateDegraded, "write timeout")
+	}
+}
@@ -0,0 +1,95 @@
+package devicestore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"touchytails/blemanager"
+)
+
+var allStates = []State{
+	StatePending, StateDisabled, StateConnecting, StateOnline,
+	StateDegraded, StateMalfunction, StateOffline,
+}
+
+func TestCanTransition(t *testing.T) {
+	// allowed lists every move the state machine accepts, besides staying
+	// put, which is always allowed
+	allowed := map[State][]State{
+		StatePending:     {StateDisabled, StateConnecting, StateOffline},
+		StateDisabled:    {StatePending},
+		StateConnecting:  {StateDisabled, StateOnline, StateOffline, StateMalfunction},
+		StateOnline:      {StateDisabled, StateDegraded, StateMalfunction, StateOffline},
+		StateDegraded:    {StateDisabled, StateOnline, StateMalfunction, StateOffline},
+		StateMalfunction: {StateDisabled, StateConnecting},
+		StateOffline:     {StateDisabled, StateConnecting},
+	}
+	for _, from := range allStates {
+		for _, to := range allStates {
+			want := from == to
+			for _, s := range allowed[from] {
+				want = want || s == to
+			}
+			t.Run(fmt.Sprintf("%s to %s", from, to), func(t *testing.T) {
+				if got := from.CanTransition(to); got != want {
+					t.Errorf("CanTransition = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestTransition(t *testing.T) {
+	s := newTestStore(t)
+	addTestDevice(s, "dev", "Tail")
+	var changes []string
+	s.OnStateChange(func(dev *Device, from, to State, reason string) {
+		changes = append(changes, fmt.Sprintf("%s->%s", from, to))
+	})
+
+	if err := s.Transition("dev", StateOnline, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Pending -> Online returned %v, want ErrInvalidTransition", err)
+	}
+	if st := s.StateOf("dev"); st != StatePending {
+		t.Errorf("state %s after a rejected move, want Pending", st)
+	}
+	if err := s.Transition("dev", StateConnecting, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Transition("dev", StateConnecting, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Transition("missing", StateConnecting, ""); err == nil {
+		t.Error("moved a device that does not exist")
+	}
+	if fmt.Sprint(changes) != "[Pending->Connecting]" {
+		t.Errorf("state change callbacks %v, want one for Pending->Connecting", changes)
+	}
+}
+
+func TestRecordSendResult(t *testing.T) {
+	s := newTestStore(t)
+	addTestDevice(s, "dev", "Tail")
+	s.Transition("dev", StateConnecting, "")
+	s.Transition("dev", StateOnline, "")
+
+	// malfunctionTimeouts timeouts in a row mark the device
+	steps := []struct {
+		err  error
+		want State
+	}{
+		{blemanager.ErrSendTimeout, StateDegraded},
+		{nil, StateOnline}, // a good write recovers and resets the count
+		{blemanager.ErrSendTimeout, StateDegraded},
+		{errors.New("not a timeout"), StateDegraded},
+		{blemanager.ErrSendTimeout, StateDegraded},
+		{blemanager.ErrSendTimeout, StateMalfunction},
+		{nil, StateMalfunction}, // only a reconnect leaves Malfunction
+	}
+	for i, step := range steps {
+		s.RecordSendResult("dev", step.err)
+		if got := s.StateOf("dev"); got != step.want {
+			t.Fatalf("step %d (%v): state %s, want %s", i, step.err, got, step.want)
+		}
+	}
+}
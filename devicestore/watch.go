@@ -0,0 +1,198 @@
+// --- devicestore/watch.go ---
+package devicestore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay lets editors finish writing before the file is read
+const reloadDelay = 300 * time.Millisecond
+
+// ReloadResult describes an external edit merged into the store
+type ReloadResult struct {
+	Added   []string
+	Updated []string
+	Removed []string
+	// Conflicts lists devices whose unsaved in-app changes were replaced
+	// by the external edit
+	Conflicts []string
+	// Invalid explains the entries of the file that were out of range and
+	// kept their current values
+	Invalid []error
+}
+
+// Watch merges external edits of the config file into the store until ctx
+// is cancelled. onReload is called after every merge, or with an error when
+// the edited file can't be read; the store is left untouched in that case.
+func (s *DeviceStore) Watch(ctx context.Context, onReload func(ReloadResult, error)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// Watch the directory: editors and Save replace the file by renaming,
+	// which would end a watch on the file itself.
+	if err := w.Add(filepath.Dir(s.path)); err != nil {
+		return err
+	}
+	base := filepath.Base(s.path)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Base(ev.Name) == base && ev.Has(fsnotify.Write|fsnotify.Create) {
+				debounce = time.After(reloadDelay)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			onReload(ReloadResult{}, err)
+		case <-debounce:
+			debounce = nil
+			res, changed, err := s.reload()
+			if err != nil || changed {
+				onReload(res, err)
+			}
+		}
+	}
+}
+
+// reload reads the config file and merges it if it differs from what the
+// store wrote last. A missing file is ignored rather than wiping devices.
+func (s *DeviceStore) reload() (ReloadResult, bool, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ReloadResult{}, false, nil
+		}
+		return ReloadResult{}, false, err
+	}
+
+	s.mu.Lock()
+	own := bytes.Equal(data, s.lastWritten)
+	s.mu.Unlock()
+	if own {
+		return ReloadResult{}, false, nil
+	}
+
+	p, _, err := decodeConfig(data)
+	if err != nil {
+		return ReloadResult{}, false, err
+	}
+	res := s.mergeExternal(p)
+
+	s.mu.Lock()
+	s.lastWritten = data
+	s.mu.Unlock()
+	return res, true, nil
+}
+
+// mergeExternal applies the settings in p to the live store. Devices keep
+// their runtime state, so open BLE connections survive the reload. Entries
+// are checked as on import; invalid ones keep their current values.
+func (s *DeviceStore) mergeExternal(p *Profile) ReloadResult {
+	var res ReloadResult
+
+	s.mu.Lock()
+	groups := make([]*Group, 0, len(p.Groups))
+	for _, src := range p.Groups {
+		g, err := src.checked()
+		if err != nil {
+			res.Invalid = append(res.Invalid, fmt.Errorf("group %q: %w", src.Name, err))
+			if cur := s.findGroupUnlocked(g.Name); cur != nil {
+				groups = append(groups, cur)
+			}
+			continue
+		}
+		groups = append(groups, &g)
+	}
+	s.groups = groups
+	if err := p.Settings.Validate(); err != nil {
+		res.Invalid = append(res.Invalid, fmt.Errorf("settings: %w", err))
+	} else {
+		s.settings = p.Settings
+	}
+
+	seen := map[string]bool{}
+	for _, src := range p.Devices {
+		seen[src.ID] = true
+		if err := src.validateSettings(); err != nil {
+			res.Invalid = append(res.Invalid, fmt.Errorf("device %s: %w", src.ID, err))
+			continue
+		}
+		dev := s.findUnlocked(src.ID)
+		if dev == nil {
+			dev = &Device{ID: src.ID}
+			dev.applySettings(src)
+			dev.Name = s.importNameUnlocked(src.ID, src.Name, src.ID)
+			dev.State = StatePending
+			if !s.activeUnlocked(dev) {
+				dev.State = StateDisabled
+			}
+			s.devices = append(s.devices, dev)
+			res.Added = append(res.Added, src.ID)
+			continue
+		}
+
+		checked := *src
+		checked.Name = s.importNameUnlocked(dev.ID, src.Name, dev.Name)
+		if dev.sameSettings(&checked) {
+			continue
+		}
+		if s.dirtyIDs[dev.ID] {
+			res.Conflicts = append(res.Conflicts, dev.ID)
+		}
+		dev.applySettings(&checked)
+		res.Updated = append(res.Updated, dev.ID)
+	}
+
+	kept := s.devices[:0]
+	for _, d := range s.devices {
+		switch {
+		case seen[d.ID]:
+			kept = append(kept, d)
+		case s.dirtyIDs[d.ID]:
+			// added in the app but not saved yet: keep it, the next
+			// save writes it back
+			kept = append(kept, d)
+			res.Conflicts = append(res.Conflicts, d.ID)
+		default:
+			if d.BLEPtr != nil {
+				d.BLEPtr.Disconnect()
+				d.BLEPtr = nil
+			}
+			d.State = StateDisabled
+			res.Removed = append(res.Removed, d.ID)
+		}
+	}
+	s.devices = kept
+	s.mu.Unlock()
+
+	// Enabled flags of devices or groups may have changed
+	s.syncActive(s.allIDs())
+	return res
+}
+
+// sameSettings reports whether d already has the persistent settings of src
+func (d *Device) sameSettings(src *Device) bool {
+	samePos := (d.Position == nil) == (src.Position == nil) &&
+		(d.Position == nil || *d.Position == *src.Position)
+	return d.Name == src.Name && d.Enabled == src.Enabled && d.Event == src.Event &&
+		d.Group == src.Group && d.Limits == src.Limits && d.Mapping == src.Mapping && samePos &&
+		d.BHaptics == src.BHaptics
+}
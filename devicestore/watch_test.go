@@ -0,0 +1,161 @@
+package devicestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+const watchedConfig = `{"version":2,
+"devices":[
+	{"id":"aa","name":"Tail","enabled":true,"event":"TailTouch","limits":{"max_intensity":0.5}},
+	{"id":"bb","name":"Ear","enabled":true,"event":"EarTouch"}
+],
+"groups":[{"name":"Back","enabled":true,"intensity":0.5}],
+"settings":{"api_port":8765}}`
+
+// newWatchedStore returns a store loaded from a file with devices aa and
+// bb, both connected through a fake link
+func newWatchedStore(t *testing.T) (*DeviceStore, string, map[string]*fakeLink) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "devices.json")
+	writeFile(t, path, watchedConfig)
+	s := New(path)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Flush() })
+	links := map[string]*fakeLink{}
+	for _, id := range []string{"aa", "bb"} {
+		links[id] = &fakeLink{ready: true}
+		s.SetBLE(id, links[id])
+	}
+	return s, path, links
+}
+
+func reloadOK(t *testing.T, s *DeviceStore) ReloadResult {
+	t.Helper()
+	res, changed, err := s.reload()
+	if err != nil || !changed {
+		t.Fatalf("reload: changed %v, err %v", changed, err)
+	}
+	return res
+}
+
+func TestReloadCleanDevice(t *testing.T) {
+	s, path, links := newWatchedStore(t)
+	writeFile(t, path, `{"version":2,"devices":[
+		{"id":"aa","name":"Big tail","enabled":true,"event":"Wag"},
+		{"id":"bb","name":"Ear","enabled":true,"event":"EarTouch"}]}`)
+
+	res := reloadOK(t, s)
+	if fmt.Sprint(res.Updated, res.Added, res.Removed, res.Conflicts) != "[aa] [] [] []" {
+		t.Errorf("updated %v, added %v, removed %v, conflicts %v", res.Updated, res.Added, res.Removed, res.Conflicts)
+	}
+	dev, _ := s.Get("aa")
+	if dev.Name != "Big tail" || dev.Event != "Wag" || dev.Limits != (Limits{}) {
+		t.Errorf("aa is %+v, want the file's settings", dev)
+	}
+	// The connection survives the reload
+	if dev.BLEPtr != links["aa"] {
+		t.Error("reload dropped the link of aa")
+	}
+}
+
+func TestReloadDirtyDeviceConflicts(t *testing.T) {
+	s, path, _ := newWatchedStore(t)
+	if err := s.SetEvent("aa", "InApp"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, `{"version":2,"devices":[
+		{"id":"aa","name":"Tail","enabled":true,"event":"OnDisk"},
+		{"id":"bb","name":"Ear","enabled":true,"event":"EarTouch"}]}`)
+
+	res := reloadOK(t, s)
+	if fmt.Sprint(res.Conflicts) != "[aa]" {
+		t.Errorf("conflicts %v, want [aa]", res.Conflicts)
+	}
+	if dev, _ := s.Get("aa"); dev.Event != "OnDisk" {
+		t.Errorf("event %q, want the file's", dev.Event)
+	}
+}
+
+func TestReloadRemovedDevice(t *testing.T) {
+	s, path, links := newWatchedStore(t)
+	// Added in the app and not saved yet: the reload must keep it
+	addTestDevice(s, "cc", "Paw")
+	writeFile(t, path, `{"version":2,"devices":[
+		{"id":"aa","name":"Tail","enabled":true,"event":"TailTouch","limits":{"max_intensity":0.5}}]}`)
+
+	res := reloadOK(t, s)
+	if fmt.Sprint(res.Removed, res.Conflicts) != "[bb] [cc]" {
+		t.Errorf("removed %v, conflicts %v; want [bb] [cc]", res.Removed, res.Conflicts)
+	}
+	if s.Exists("bb") || !s.Exists("cc") {
+		t.Errorf("bb exists %v, cc exists %v; want false, true", s.Exists("bb"), s.Exists("cc"))
+	}
+	if links["bb"].Ready() {
+		t.Error("removed device still connected")
+	}
+}
+
+func TestReloadIgnoresOwnWrites(t *testing.T) {
+	s, _, _ := newWatchedStore(t)
+	// What Load read is not an external edit
+	if _, changed, err := s.reload(); changed || err != nil {
+		t.Fatalf("reload after Load: changed %v, err %v", changed, err)
+	}
+	s.SetEvent("aa", "Wag")
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, changed, err := s.reload(); changed || err != nil {
+		t.Errorf("reload after Save: changed %v, err %v", changed, err)
+	}
+}
+
+func TestReloadKeepsInvalidEntries(t *testing.T) {
+	s, path, _ := newWatchedStore(t)
+	writeFile(t, path, `{"version":2,
+		"devices":[
+			{"id":"aa","name":"Tail","enabled":true,"event":"TailTouch","limits":{"max_intensity":3}},
+			{"id":"bb","name":"Ear","enabled":true,"event":"EarTouch","mapping":{"min_intensity":0.9,"max_intensity":0.2}},
+			{"id":"cc","name":"Paw","enabled":true,"event":"Two words"}
+		],
+		"groups":[{"name":"Back","enabled":true,"intensity":"x"}],
+		"settings":{"api_port":70000}}`)
+	if _, _, err := s.reload(); err == nil {
+		t.Fatal("a group intensity of the wrong type must fail to decode")
+	}
+
+	writeFile(t, path, `{"version":2,
+		"devices":[
+			{"id":"aa","name":"Tail","enabled":true,"event":"TailTouch","limits":{"max_intensity":3}},
+			{"id":"bb","name":"Ear","enabled":true,"event":"EarTouch","mapping":{"min_intensity":0.9,"max_intensity":0.2}},
+			{"id":"cc","name":"Paw","enabled":true,"event":"Two words"}
+		],
+		"groups":[{"name":"Back","enabled":true,"intensity":7},{"name":"Bad","event":"#"}],
+		"settings":{"api_port":70000}}`)
+	res := reloadOK(t, s)
+	if len(res.Invalid) != 5 {
+		t.Errorf("%d invalid entries, want 5: %v", len(res.Invalid), res.Invalid)
+	}
+	if len(res.Added)+len(res.Updated)+len(res.Removed) != 0 {
+		t.Errorf("added %v, updated %v, removed %v; want nothing", res.Added, res.Updated, res.Removed)
+	}
+	if dev, _ := s.Get("aa"); dev.Limits.MaxIntensity != 0.5 {
+		t.Errorf("aa limits %+v, want the current ones", dev.Limits)
+	}
+	if dev, _ := s.Get("bb"); dev.Mapping != (Mapping{}) {
+		t.Errorf("bb mapping %+v, want the current one", dev.Mapping)
+	}
+	if s.Exists("cc") {
+		t.Error("invalid new device added")
+	}
+	if st := s.Settings(); st.APIPort != 8765 {
+		t.Errorf("API port %d, want the current 8765", st.APIPort)
+	}
+	if g := s.Groups(); len(g) != 1 || g[0].Intensity != 1 {
+		t.Errorf("groups %+v, want Back clamped to full intensity", g)
+	}
+}
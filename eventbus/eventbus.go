@@ -0,0 +1,64 @@
+package eventbus
+
+import (
+	"sync"
+)
+
+// Event is implemented by every message published on the bus.
+// String gives the human readable line shown in the console and log.
+type Event interface {
+	String() string
+	isEvent()
+}
+
+// Bus fans published events out to independent subscribers
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[int]chan Event
+	next int
+}
+
+// New creates an empty Bus
+func New() *Bus {
+	return &Bus{subs: make(map[int]chan Event)}
+}
+
+// Subscribe returns a channel receiving every event published after the call
+// and a function that ends the subscription. A subscriber whose buffer is
+// full misses events rather than slowing the publisher down.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Publish delivers e to all subscribers without blocking
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// subscriber is behind, drop for this one only
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package eventbus
+
+import (
+	"testing"
+)
+
+func TestPublishOrder(t *testing.T) {
+	b := New()
+	events, cancel := b.Subscribe(10)
+	defer cancel()
+
+	want := []Event{
+		DeviceConnecting{ID: "a", Name: "Tail"},
+		DeviceConnected{ID: "a", Name: "Tail"},
+		OutputSent{ID: "a", Name: "Tail", Source: "TailTouch", Value: 0.5},
+		DeviceDisconnected{ID: "a", Name: "Tail"},
+	}
+	for _, e := range want {
+		b.Publish(e)
+	}
+	for i, w := range want {
+		if got := <-events; got != w {
+			t.Errorf("event %d: got %#v, want %#v", i, got, w)
+		}
+	}
+}
+
+func TestPublishFanOut(t *testing.T) {
+	b := New()
+	first, cancel1 := b.Subscribe(1)
+	defer cancel1()
+	second, cancel2 := b.Subscribe(1)
+	defer cancel2()
+
+	e := PanicStop{Stopped: 2}
+	b.Publish(e)
+	if got := <-first; got != e {
+		t.Errorf("first subscriber got %#v", got)
+	}
+	if got := <-second; got != e {
+		t.Errorf("second subscriber got %#v", got)
+	}
+}
+
+func TestPublishDropsForSlowSubscriber(t *testing.T) {
+	b := New()
+	slow, cancel1 := b.Subscribe(1)
+	defer cancel1()
+	fast, cancel2 := b.Subscribe(3)
+	defer cancel2()
+
+	for i := range 3 {
+		b.Publish(OSCReceived{Name: "TailTouch", Value: float32(i)})
+	}
+	if len(slow) != 1 || len(fast) != 3 {
+		t.Fatalf("buffered %d and %d events, want 1 and 3", len(slow), len(fast))
+	}
+	if got := (<-slow).(OSCReceived).Value; got != 0 {
+		t.Errorf("slow subscriber kept value %v, want the first one", got)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	b := New()
+	events, cancel := b.Subscribe(1)
+	cancel()
+	cancel() // a second call is harmless
+	b.Publish(PanicStop{})
+	if _, ok := <-events; ok {
+		t.Error("received an event after cancel")
+	}
+
+	var nilBus *Bus
+	nilBus.Publish(PanicStop{}) // must not panic
+}
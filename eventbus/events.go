@@ -0,0 +1,189 @@
+package eventbus
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeviceConnecting is published when a connection attempt starts
+type DeviceConnecting struct {
+	ID   string
+	Name string
+}
+
+// DeviceConnected is published once a device is ready to receive data
+type DeviceConnected struct {
+	ID   string
+	Name string
+}
+
+// DeviceDisconnected is published when a connected device goes away.
+// Disabled is true when the user switched the device off.
+type DeviceDisconnected struct {
+	ID       string
+	Name     string
+	Disabled bool
+}
+
+// DeviceStateChanged is published when a device moves to another lifecycle
+// state. States are given by name, e.g. "Online" or "Malfunction".
+type DeviceStateChanged struct {
+	ID     string
+	Name   string
+	From   string
+	To     string
+	Reason string
+}
+
+// TransitionRejected is published when the runtime tries a state change
+// the state machine does not allow
+type TransitionRejected struct {
+	ID   string
+	Name string
+	To   string
+	Err  error
+}
+
+// ConnectFailed is published when a connection attempt fails
+type ConnectFailed struct {
+	ID      string
+	Name    string
+	Err     error
+	RetryIn time.Duration
+}
+
+// SendFailed is published when a write to a device fails or times out
+type SendFailed struct {
+	ID   string
+	Name string
+	Data string
+	Err  error
+}
+
+// OutputSent is published after a value was written to a device.
+// Source says what triggered it, e.g. an OSC parameter or "Beep".
+type OutputSent struct {
+	ID     string
+	Name   string
+	Source string
+	Value  float32
+}
+
+// LimitChanged is published when a device limit starts or stops reducing
+// output. Limit names the limit, e.g. "duty limit", and is empty once no
+// limit applies anymore.
+type LimitChanged struct {
+	ID    string
+	Name  string
+	Limit string
+}
+
+// PanicStop is published after a stop-all wrote the stop command to every
+// connected device. Failed counts devices whose write did not go through.
+type PanicStop struct {
+	Stopped int
+	Failed  int
+}
+
+// BatteryChanged is published when a device reports a new battery level,
+// 0..1
+type BatteryChanged struct {
+	ID    string
+	Name  string
+	Level float32
+}
+
+// OSCReceived is published for every avatar parameter received over OSC
+type OSCReceived struct {
+	Name  string
+	Value float32
+}
+
+// ScanResult is published for every advertisement seen during discovery.
+// Target is true when the advertiser is a TouchyTails device.
+type ScanResult struct {
+	Name    string
+	Address string
+	Target  bool
+}
+
+func (DeviceConnecting) isEvent()   {}
+func (DeviceConnected) isEvent()    {}
+func (DeviceDisconnected) isEvent() {}
+func (DeviceStateChanged) isEvent() {}
+func (TransitionRejected) isEvent() {}
+func (ConnectFailed) isEvent()      {}
+func (SendFailed) isEvent()         {}
+func (OutputSent) isEvent()         {}
+func (LimitChanged) isEvent()       {}
+func (PanicStop) isEvent()          {}
+func (BatteryChanged) isEvent()     {}
+func (OSCReceived) isEvent()        {}
+func (ScanResult) isEvent()         {}
+
+func (e DeviceConnecting) String() string {
+	return fmt.Sprintf("Scanning/connecting to %s (%s)...", e.Name, e.ID)
+}
+
+func (e DeviceConnected) String() string {
+	return fmt.Sprintf("%s connected!", e.Name)
+}
+
+func (e DeviceDisconnected) String() string {
+	if e.Disabled {
+		return fmt.Sprintf("%s disconnected (disabled)", e.Name)
+	}
+	return fmt.Sprintf("%s disconnected", e.Name)
+}
+
+func (e DeviceStateChanged) String() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s: %s -> %s (%s)", e.Name, e.From, e.To, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s -> %s", e.Name, e.From, e.To)
+}
+
+func (e TransitionRejected) String() string {
+	return fmt.Sprintf("%s: cannot move to %s: %v", e.Name, e.To, e.Err)
+}
+
+func (e ConnectFailed) String() string {
+	return fmt.Sprintf("Failed to connect %s: %v (retry in %s)", e.Name, e.Err, e.RetryIn.Round(time.Second))
+}
+
+func (e SendFailed) String() string {
+	return fmt.Sprintf("Send to %s failed: %v", e.Name, e.Err)
+}
+
+func (e OutputSent) String() string {
+	return fmt.Sprintf("%s: %s -> %.2f", e.Name, e.Source, e.Value)
+}
+
+func (e LimitChanged) String() string {
+	if e.Limit == "" {
+		return e.Name + ": output no longer limited"
+	}
+	return e.Name + ": output reduced by " + e.Limit
+}
+
+func (e PanicStop) String() string {
+	if e.Failed > 0 {
+		return fmt.Sprintf("Stop all: %d devices stopped, %d did not respond. Output is muted.", e.Stopped, e.Failed)
+	}
+	return fmt.Sprintf("Stop all: %d devices stopped. Output is muted.", e.Stopped)
+}
+
+func (e BatteryChanged) String() string {
+	return fmt.Sprintf("%s battery at %.0f%%", e.Name, e.Level*100)
+}
+
+func (e OSCReceived) String() string {
+	return fmt.Sprintf("OSC %s = %.2f", e.Name, e.Value)
+}
+
+func (e ScanResult) String() string {
+	if e.Target {
+		return "Found target: " + e.Name + " [" + e.Address + "]"
+	}
+	return "Found: " + e.Name + " [" + e.Address + "]"
+}
@@ -1,6 +1,8 @@
 @echo off
 
-REM Launch in a new window and immediately return
+REM Launch in a new window and immediately return.
+REM Devices are kept in %AppData%\TouchyTails\devices.json; pass
+REM --config <path> after "go run ." to use another file.
 start "" cmd /c "go run ."
 
 exit
@@ -4,7 +4,9 @@ go 1.24.6
 
 require (
 	fyne.io/fyne/v2 v2.6.3
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/hypebeast/go-osc v0.0.0-20220308234300-cec5a8a1e5f5
+	golang.org/x/net v0.35.0
 	tinygo.org/x/bluetooth v0.13.0
 )
 
@@ -13,7 +15,6 @@ require (
 	github.com/BurntSushi/toml v1.4.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fredbi/uri v1.1.0 // indirect
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/fyne-io/gl-js v0.2.0 // indirect
 	github.com/fyne-io/glfw-js v0.3.0 // indirect
 	github.com/fyne-io/image v0.1.1 // indirect
@@ -45,7 +46,6 @@ require (
 	github.com/yuin/goldmark v1.7.8 // indirect
 	golang.org/x/exp v0.0.0-20241204233417-43b7b7cde48d // indirect
 	golang.org/x/image v0.24.0 // indirect
-	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -2,21 +2,31 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"image/color"
-	"math/rand/v2"
+	"strconv"
 	"strings"
+	"touchytails/blemanager"
 	"touchytails/devicestore"
+	"touchytails/hotkey"
+	"touchytails/logstore"
+	"touchytails/oscmanager"
+	"touchytails/outputmanager"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
 )
 
 // --- Status handling ---
 var statusColors = map[string]color.RGBA{
 	"Online":      {0, 200, 0, 255},
+	"Degraded":    {200, 200, 0, 255},
+	"Connecting":  {100, 150, 255, 255},
 	"Offline":     {200, 0, 0, 255},
 	"Malfunction": {200, 100, 0, 255},
 	"Disabled":    {150, 150, 150, 255},
@@ -48,160 +58,246 @@ func applyStatus(label *canvas.Text, text string) {
 }
 
 // --- GUI posting helper ---
+
+// postGUI runs a one-off job, such as showing a dialog, on the GUI thread.
+// It never blocks the caller. Recurring state belongs in the UI model.
 func postGUI(job func()) {
-	guiChan <- func() { fyne.Do(job) }
+	if appCtx.Err() != nil {
+		return // shutting down, the window is already gone
+	}
+	fyne.Do(job)
 }
 
-// --- Console handling ---
-type Console struct {
-	widget *widget.Entry
-	limit  int
+// testPulseValue is the strength of the pulse used to find a device by feel
+const testPulseValue = 0.7
+
+// sendTestPulse writes a single value to a device through the output
+// manager. It returns false, after logging why, when nothing was written.
+func sendTestPulse(console *Console, id string, value float32, source string) bool {
+	dev, ok := store.Get(id)
+	if !ok {
+		return false
+	}
+	err := output.Send(dev, value, source)
+	switch {
+	case errors.Is(err, outputmanager.ErrMuted):
+		console.Log(logstore.LevelWarn, dev.Name, "output", "Output muted, cannot test")
+	case errors.Is(err, outputmanager.ErrLimited):
+		console.Log(logstore.LevelWarn, dev.Name, "limits", "Limit reached, cannot test")
+	case errors.Is(err, blemanager.ErrNotReady):
+		console.Log(logstore.LevelWarn, dev.Name, "ble", "Device offline, cannot test")
+	}
+	return err == nil
 }
 
-func newConsole(limit int) *Console {
-	c := &Console{
-		widget: widget.NewMultiLineEntry(),
-		limit:  limit,
+// --- OSC listener panel ---
+
+// oscPanel shows whether the OSC listener is up and lets the user retry
+// it, optionally on another port, while BLE management keeps running.
+type oscPanel struct {
+	status   *canvas.Text
+	port     *widget.Entry
+	retryBtn *widget.Button
+}
+
+func newOSCPanel(port int, onRetry func(port int)) *oscPanel {
+	p := &oscPanel{
+		status: canvas.NewText("OSC: starting...", statusColors["Pending"]),
+		port:   widget.NewEntry(),
+	}
+	p.status.TextSize = 14
+	p.port.SetText(strconv.Itoa(port))
+	p.port.Validator = func(text string) error {
+		if _, err := parsePort(text); err != nil {
+			return err
+		}
+		return nil
 	}
-	c.widget.SetPlaceHolder("Console output...")
-	c.widget.Wrapping = fyne.TextWrapWord
-	c.widget.Disable()
-	return c
+	p.retryBtn = widget.NewButton("Retry", func() {
+		port, err := parsePort(p.port.Text)
+		if err != nil {
+			p.setStatus("OSC: "+err.Error(), "Offline")
+			return
+		}
+		p.retryBtn.Disable()
+		p.setStatus("OSC: starting...", "Pending")
+		onRetry(port)
+	})
+	p.retryBtn.Disable()
+	return p
+}
+
+func (p *oscPanel) object() fyne.CanvasObject {
+	return container.NewHBox(p.status, widget.NewLabel("Port"), p.port, p.retryBtn)
 }
 
-// Append text safely to console
-func (c *Console) append(line string) {
-	lines := strings.Split(c.widget.Text, "\n")
-	lines = append(lines, line)
-	if len(lines) > c.limit {
-		lines = lines[len(lines)-c.limit:]
+// setListening must run on the GUI thread
+func (p *oscPanel) setListening(addr string) {
+	p.setStatus("OSC: listening on "+addr, "Online")
+	p.retryBtn.Disable()
+}
+
+// setFailed must run on the GUI thread
+func (p *oscPanel) setFailed(err error) {
+	if errors.Is(err, oscmanager.ErrPortInUse) {
+		p.setStatus("OSC: port "+p.port.Text+" in use, close the other app or pick another port", "Offline")
+	} else {
+		p.setStatus("OSC: "+err.Error(), "Offline")
 	}
-	c.widget.SetText(strings.Join(lines, "\n"))
-	c.widget.CursorRow = len(lines)
+	p.retryBtn.Enable()
 }
 
-// Public method to append via GUI safely
-func (c *Console) Append(line string) {
-	postGUI(func() { c.append(line) })
+func (p *oscPanel) setStatus(text, state string) {
+	p.status.Text = text
+	p.status.Color = statusColors[state]
+	p.status.Refresh()
 }
 
-// Apply status change to device via GUI
-func (c *Console) ApplyStatus(dev *devicestore.Device, status string) {
-	postGUI(func() { applyStatus(dev.Status, status) })
+func parsePort(text string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", text)
+	}
+	return port, nil
 }
 
-// --- Device UI ---
-func buildDeviceUI(d *devicestore.Device, console *Console, store *devicestore.DeviceStore, refreshDevices func()) *fyne.Container {
-	// --- Labels & Entries ---
-	if d.Status == nil {
-		d.Status = newStatus("Pending")
+// --- Output panel ---
+
+// stopAllShortcut triggers a stop-all from anywhere in the window, even
+// while a text field has focus. On Windows registerStopHotkey makes the
+// same keys work system-wide.
+var stopAllShortcut = &desktop.CustomShortcut{KeyName: fyne.KeyX, Modifier: fyne.KeyModifierShortcutDefault | fyne.KeyModifierShift}
+
+// registerStopHotkey makes Ctrl+Shift+X stop everything even while VRChat
+// has focus or the window is hidden in the tray, where the platform allows
+// it. Elsewhere the window shortcut and the tray menu remain.
+func registerStopHotkey(console *Console) {
+	err := hotkey.Register(appCtx, hotkey.Ctrl|hotkey.Shift, 'X', func() { postGUI(outputView.stopAll) })
+	switch {
+	case err == nil:
+		console.Log(logstore.LevelInfo, "", "output", "Ctrl+Shift+X stops all devices from any program")
+	case errors.Is(err, hotkey.ErrUnsupported):
+		console.Log(logstore.LevelDebug, "", "output", "Stop All shortcut only works in this window; the tray menu has Stop All too")
+	default:
+		console.Log(logstore.LevelWarn, "", "output", "Ctrl+Shift+X only works in this window, another program owns it: "+err.Error())
 	}
-	idLabel := canvas.NewText(d.ID, color.White)
-	idLabel.TextSize = 6
-	idLabel.Alignment = fyne.TextAlignCenter
-	idLabel.Resize(fyne.NewSize(50, 20))
+}
 
-	nameEntry := widget.NewEntry()
-	nameEntry.SetText(d.Name)
+// outputView is the output panel of the main window
+var outputView *outputPanel
 
-	eventEntry := widget.NewEntry()
-	eventEntry.SetText(d.Event)
+// outputPanel holds the master intensity, mute and stop-all controls
+type outputPanel struct {
+	master  *widget.Slider
+	percent *widget.Label
+	mute    *widget.Check
+	stopBtn *widget.Button
+}
 
-	statusLabel := d.Status
+func newOutputPanel() *outputPanel {
+	p := &outputPanel{
+		master:  widget.NewSlider(0, 100),
+		percent: widget.NewLabel(""),
+	}
+	p.master.Step = 1
+	p.master.OnChanged = func(v float64) {
+		output.SetMaster(float32(v / 100))
+		p.percent.SetText(fmt.Sprintf("%3.0f%%", v))
+	}
+	p.master.SetValue(float64(output.Master() * 100))
+	p.mute = widget.NewCheck("Mute", func(muted bool) {
+		output.SetMuted(muted)
+	})
+	p.stopBtn = widget.NewButton("Stop All", p.stopAll)
+	p.stopBtn.Importance = widget.DangerImportance
+	return p
+}
 
-	// --- Handlers ---
-	onBeep := func() {
-		if d.BLEPtr == nil || !d.Online {
-			console.Append("Device offline, cannot beep: " + d.ID)
-			return
-		}
-		val := 0.4 + rand.Float64()*0.6
-		d.BLEPtr.Send(fmt.Sprintf("%.2f", val))
-		console.Append(fmt.Sprintf("Beep: %.2f for %s", val, d.ID))
-	}
-
-	onToggleEnabled := func(enabled bool) {
-		d.Enabled = enabled
-		store.Save()
-		postGUI(func() {
-			if !d.Enabled {
-				if d.BLEPtr != nil {
-					d.BLEPtr.Disconnect()
-					d.BLEPtr = nil
-				}
-				applyStatus(statusLabel, "Disabled")
-			} else if d.Online {
-				applyStatus(statusLabel, "Online")
-			} else {
-				applyStatus(statusLabel, "Pending")
-			}
-			console.Append(fmt.Sprintf("%s for %s", statusLabel.Text, d.ID))
-		})
+func (p *outputPanel) object() fyne.CanvasObject {
+	return container.NewBorder(nil, nil,
+		widget.NewLabel("Master"),
+		container.NewHBox(p.percent, p.mute, p.stopBtn),
+		p.master)
+}
+
+// sync shows a mute switched outside the panel, e.g. by a stop-all from
+// the local API. GUI thread only.
+func (p *outputPanel) sync() {
+	if muted := output.Muted(); p.mute.Checked != muted {
+		p.mute.SetChecked(muted)
 	}
+}
 
-	onRemove := func() {
-		d.Enabled = false
-		if d.BLEPtr != nil {
-			d.BLEPtr.Disconnect()
-			d.BLEPtr = nil
+// stopAll mutes output and sends the stop command to every connected device.
+// Must run on the GUI thread.
+func (p *outputPanel) stopAll() {
+	p.mute.SetChecked(true)
+	go output.Panic()
+}
+
+// --- Limits ---
+
+// askLimits edits the safety limits of a device. Empty fields mean no limit.
+func askLimits(id string, console *Console) {
+	dev, ok := store.Get(id)
+	if !ok {
+		return
+	}
+	intensity := limitEntry(dev.Limits.MaxIntensity*100, "e.g. 80")
+	onTime := limitEntry(dev.Limits.MaxOnSeconds, "e.g. 30")
+	duty := limitEntry(dev.Limits.MaxDuty*100, "e.g. 50")
+	percent := func(text string) error {
+		v, err := parseLimit(text)
+		if err == nil && v > 100 {
+			err = errors.New("must be at most 100")
 		}
-		store.Remove(d.ID)
-		refreshDevices()
-	}
-
-	onNameChanged := func(newName string) {
-		d.Name = newName
-		store.Save()
-		console.Append("Name updated for " + d.ID)
-	}
-
-	onEventChanged := func(newEvent string) {
-		d.Event = newEvent
-		store.Save()
-		console.Append("Event updated for " + d.ID)
-	}
-
-	// --- Widgets ---
-	beepBtn := widget.NewButton("Beep", onBeep)
-	enabledCheck := widget.NewCheck("Enabled", onToggleEnabled)
-	enabledCheck.SetChecked(d.Enabled)
-	nameEntry.OnChanged = onNameChanged
-	eventEntry.OnChanged = onEventChanged
-	removeBtn := widget.NewButton("Remove", onRemove)
-
-	// --- Layout ---
-	row := container.NewGridWithColumns(7,
-		idLabel, nameEntry, statusLabel, beepBtn, enabledCheck, eventEntry, removeBtn,
-	)
-
-	return container.NewBorder(nil, nil, nil, nil, row)
-}
-
-// Refresh the device list
-func refreshDevices(deviceList *fyne.Container, console *Console, store *devicestore.DeviceStore) {
-	postGUI(func() {
-		deviceList.Objects = nil
-
-		// Header
-		header := container.NewGridWithColumns(7,
-			widget.NewLabelWithStyle("ID", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-			widget.NewLabelWithStyle("Name", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-			widget.NewLabelWithStyle("Status", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-			widget.NewLabelWithStyle("Beep", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-			widget.NewLabelWithStyle("Enabled", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-			widget.NewLabelWithStyle("Event", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-			widget.NewLabelWithStyle("Remove", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-		)
-		deviceList.Add(header)
-
-		// Device rows
-		for _, d := range store.All() {
-			if d.Status == nil {
-				d.Status = newStatus("Pending")
+		return err
+	}
+	intensity.Validator = percent
+	duty.Validator = percent
+	onTime.Validator = func(text string) error {
+		_, err := parseLimit(text)
+		return err
+	}
+
+	dialog.ShowForm("Limits for "+dev.Name, "Save", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Max intensity (%)", intensity),
+			widget.NewFormItem("Max on-time (s)", onTime),
+			widget.NewFormItem(fmt.Sprintf("Max duty per %.0fs (%%)", devicestore.DutyWindow.Seconds()), duty),
+		},
+		func(ok bool) {
+			if !ok {
+				return
 			}
-			deviceList.Add(buildDeviceUI(d, console, store, func() { refreshDevices(deviceList, console, store) }))
-		}
+			i, _ := parseLimit(intensity.Text)
+			o, _ := parseLimit(onTime.Text)
+			u, _ := parseLimit(duty.Text)
+			l := devicestore.Limits{MaxIntensity: i / 100, MaxOnSeconds: o, MaxDuty: u / 100}
+			if err := store.SetLimits(id, l); err != nil {
+				console.Log(logstore.LevelWarn, "", "limits", "Limits not saved: "+err.Error())
+			}
+		}, mainWindow)
+}
 
-		deviceList.Refresh()
-	})
+func limitEntry(v float32, hint string) *widget.Entry {
+	e := widget.NewEntry()
+	e.SetPlaceHolder(hint + ", empty for none")
+	if v > 0 {
+		e.SetText(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	}
+	return e
+}
+
+// parseLimit reads a non-negative number; empty text means no limit
+func parseLimit(text string) (float32, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(text, 32)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	return float32(v), nil
 }
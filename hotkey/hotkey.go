@@ -0,0 +1,18 @@
+// Package hotkey registers keyboard shortcuts that work system-wide, even
+// while another program such as VRChat has focus or the app is hidden in
+// the tray.
+package hotkey
+
+import "errors"
+
+// ErrUnsupported is returned where system-wide hotkeys are not available
+var ErrUnsupported = errors.New("system-wide hotkeys are not supported on this platform")
+
+// Modifier is a set of modifier keys
+type Modifier int
+
+const (
+	Alt Modifier = 1 << iota
+	Ctrl
+	Shift
+)
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package hotkey
+
+import "context"
+
+// Register returns ErrUnsupported; outside Windows shortcuts only work
+// while the app window has focus
+func Register(ctx context.Context, mods Modifier, key rune, fn func()) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,93 @@
+package hotkey
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	user32                 = syscall.NewLazyDLL("user32.dll")
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procRegisterHotKey     = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey   = user32.NewProc("UnregisterHotKey")
+	procGetMessage         = user32.NewProc("GetMessageW")
+	procPostThreadMessage  = user32.NewProc("PostThreadMessageW")
+	procGetCurrentThreadID = kernel32.NewProc("GetCurrentThreadId")
+)
+
+const (
+	modAlt      = 0x0001
+	modControl  = 0x0002
+	modShift    = 0x0004
+	modNoRepeat = 0x4000
+	wmQuit      = 0x0012
+	wmHotkey    = 0x0312
+	hotkeyID    = 1
+)
+
+// msg is the Win32 MSG structure
+type msg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+// Register calls fn, on its own goroutine, whenever mods+key is pressed
+// anywhere until ctx is done. key is an upper case letter or digit. It
+// fails if another program already owns the combination.
+func Register(ctx context.Context, mods Modifier, key rune, fn func()) error {
+	var winMods uintptr = modNoRepeat
+	if mods&Alt != 0 {
+		winMods |= modAlt
+	}
+	if mods&Ctrl != 0 {
+		winMods |= modControl
+	}
+	if mods&Shift != 0 {
+		winMods |= modShift
+	}
+
+	// The hotkey belongs to the thread that registered it, which must
+	// then run the message loop
+	registered := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		thread, _, _ := procGetCurrentThreadID.Call()
+		if r, _, err := procRegisterHotKey.Call(0, hotkeyID, winMods, uintptr(key)); r == 0 {
+			registered <- fmt.Errorf("register hotkey: %w", err)
+			return
+		}
+		defer procUnregisterHotKey.Call(0, hotkeyID)
+		registered <- nil
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				procPostThreadMessage.Call(thread, wmQuit, 0, 0)
+			case <-done:
+			}
+		}()
+
+		var m msg
+		for {
+			r, _, _ := procGetMessage.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r) <= 0 { // WM_QUIT or an error
+				return
+			}
+			if m.message == wmHotkey {
+				go fn()
+			}
+		}
+	}()
+	return <-registered
+}
@@ -0,0 +1,95 @@
+package logstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is an append-only log file that moves to path.1 once it
+// grows past maxSize, keeping up to keep older files as path.1..keep.
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	f       *os.File
+	size    int64
+}
+
+// OpenRotatingFile opens path for appending, creating its directory
+func OpenRotatingFile(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &RotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Path returns the path of the current log file
+func (r *RotatingFile) Path() string {
+	return r.path
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// WriteLine appends line and a newline, rotating first if the file is full.
+// Write errors are dropped: logging must never stop the app.
+func (r *RotatingFile) WriteLine(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return
+	}
+	if r.size+int64(len(line))+1 > r.maxSize && r.size > 0 {
+		r.rotateUnlocked()
+		if r.f == nil {
+			return
+		}
+	}
+	n, _ := r.f.WriteString(line + "\n")
+	r.size += int64(n)
+}
+
+// rotateUnlocked shifts path.N-1 to path.N, ..., path to path.1
+func (r *RotatingFile) rotateUnlocked() {
+	r.f.Close()
+	r.f = nil
+	for i := r.keep; i > 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i-1), fmt.Sprintf("%s.%d", r.path, i))
+	}
+	if r.keep > 0 {
+		os.Rename(r.path, r.path+".1")
+	} else {
+		os.Remove(r.path)
+	}
+	r.open()
+}
+
+// Close closes the file; later writes are dropped
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
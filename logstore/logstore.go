@@ -0,0 +1,199 @@
+package logstore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Levels lists all levels from least to most severe
+var Levels = []Level{LevelDebug, LevelInfo, LevelWarn, LevelError}
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Entry is one log line. Device is the device name, empty for app-wide
+// messages; Source says which part of the app wrote it, e.g. "ble" or "osc".
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Device  string
+	Source  string
+	Message string
+	// Seq numbers entries in the order they were added, set by Add
+	Seq uint64
+}
+
+func (e Entry) String() string {
+	var b strings.Builder
+	b.WriteString(e.Time.Format("2006-01-02 15:04:05.000 "))
+	fmt.Fprintf(&b, "%-5s ", e.Level)
+	if e.Device != "" {
+		b.WriteString("[" + e.Device + "] ")
+	}
+	if e.Source != "" {
+		b.WriteString(e.Source + ": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Filter selects entries. Zero fields match everything.
+type Filter struct {
+	MinLevel Level
+	Device   string
+	// Search matches the message, device and source, ignoring case
+	Search string
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Entry) bool {
+	if e.Level < f.MinLevel {
+		return false
+	}
+	if f.Device != "" && e.Device != f.Device {
+		return false
+	}
+	if f.Search != "" {
+		q := strings.ToLower(f.Search)
+		return strings.Contains(strings.ToLower(e.Message), q) ||
+			strings.Contains(strings.ToLower(e.Device), q) ||
+			strings.Contains(strings.ToLower(e.Source), q)
+	}
+	return true
+}
+
+// Store keeps the most recent entries in memory and copies every entry to
+// an optional rotating file. It is safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	entries []Entry // ring buffer
+	start   int     // index of the oldest entry
+	count   int
+	seq     uint64 // bumped on every Add
+	file    *RotatingFile
+}
+
+// New creates a Store that keeps up to capacity entries in memory
+func New(capacity int) *Store {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Store{entries: make([]Entry, capacity)}
+}
+
+// SetFile copies all further entries to f
+func (s *Store) SetFile(f *RotatingFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file = f
+}
+
+// Add records an entry, stamping it with the current time if unset
+func (s *Store) Add(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.mu.Lock()
+	s.seq++
+	e.Seq = s.seq
+	i := (s.start + s.count) % len(s.entries)
+	s.entries[i] = e
+	if s.count < len(s.entries) {
+		s.count++
+	} else {
+		s.start = (s.start + 1) % len(s.entries)
+	}
+	f := s.file
+	s.mu.Unlock()
+
+	if f != nil {
+		f.WriteLine(e.String())
+	}
+}
+
+// Seq returns a counter that changes whenever an entry is added, so
+// readers can skip work when nothing is new
+func (s *Store) Seq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// Entries returns the entries matching f, oldest first, and the sequence
+// number of the newest entry for a later Since
+func (s *Store) Entries(f Filter) (out []Entry, last uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for n := 0; n < s.count; n++ {
+		e := s.entries[(s.start+n)%len(s.entries)]
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out, s.seq
+}
+
+// Since returns the entries matching f that were added after sequence
+// number seq, oldest first, and the sequence number of the newest entry.
+// ok is false if some of the entries after seq are no longer in memory.
+func (s *Store) Since(seq uint64, f Filter) (out []Entry, last uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := s.seq - seq
+	if seq > s.seq || added > uint64(s.count) {
+		return nil, s.seq, false
+	}
+	for n := s.count - int(added); n < s.count; n++ {
+		if e := s.entries[(s.start+n)%len(s.entries)]; f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out, s.seq, true
+}
+
+// First returns the sequence number of the oldest entry in memory
+func (s *Store) First() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq - uint64(s.count) + 1
+}
+
+// Devices returns the distinct device names in memory, in order of first
+// appearance
+func (s *Store) Devices() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[string]bool{}
+	var out []string
+	for n := 0; n < s.count; n++ {
+		d := s.entries[(s.start+n)%len(s.entries)].Device
+		if d != "" && !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
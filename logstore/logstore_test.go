@@ -0,0 +1,32 @@
+package logstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSince(t *testing.T) {
+	s := New(3)
+	for i := range 2 {
+		s.Add(Entry{Level: LevelInfo, Message: fmt.Sprint(i)})
+	}
+	_, seen, _ := s.Since(0, Filter{})
+
+	s.Add(Entry{Level: LevelDebug, Message: "2"})
+	s.Add(Entry{Level: LevelWarn, Message: "3"})
+	got, last, ok := s.Since(seen, Filter{MinLevel: LevelInfo})
+	if !ok || last != 4 || len(got) != 1 || got[0].Message != "3" || got[0].Seq != 4 {
+		t.Errorf("Since(%d) = %v, %d, %v; want [3], 4, true", seen, got, last, ok)
+	}
+	if got, _, ok := s.Since(last, Filter{}); !ok || len(got) != 0 {
+		t.Errorf("nothing new: got %v, %v", got, ok)
+	}
+	if first := s.First(); first != 2 {
+		t.Errorf("First = %d, want 2", first)
+	}
+
+	// Entry 1 was pushed out of memory, so a reader at 0 must reload
+	if _, _, ok := s.Since(0, Filter{}); ok {
+		t.Error("Since(0) ok after entries were dropped")
+	}
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"flag"
 	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 	"touchytails/blemanager"
 	"touchytails/devicestore"
+	"touchytails/eventbus"
+	"touchytails/logstore"
 	"touchytails/oscmanager"
+	"touchytails/outputmanager"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"tinygo.org/x/bluetooth"
 )
@@ -18,93 +29,210 @@ import (
 //go:embed icon.png
 var iconData []byte
 
-var guiChan = make(chan func(), 50)
 var oscChan = make(chan oscmanager.OSCMessage, 1)
-var store = devicestore.New("devices.json")
+var store *devicestore.DeviceStore
+var runtimeMgr *devicestore.RuntimeManager
+var output *outputmanager.OutputManager
+var bus = eventbus.New()
+
+// appCtx is cancelled when the window closes; background workers watch it
+var appCtx, stopApp = context.WithCancel(context.Background())
+var background sync.WaitGroup
+
+const shutdownTimeout = 5 * time.Second
+
+const (
+	logCapacity = 5000    // entries kept in memory for the console
+	logMaxSize  = 1 << 20 // bytes per log file before it rotates
+	logKeep     = 3       // rotated log files kept next to the current one
+)
+
+// logFile receives a copy of every console entry, nil if it can't be opened
+var logFile *logstore.RotatingFile
+
+const (
+	oscHost        = "127.0.0.1"
+	defaultOSCPort = 9001
+)
 
 func main() {
+	flag.Parse()
+	configPath, migratedFrom, err := resolveConfigPath()
+	if err != nil {
+		log.Println("Config directory unavailable, using working directory:", err)
+		configPath = configFileName
+	}
+	store = devicestore.New(configPath)
+	output = outputmanager.New(store, bus)
+
+	if ran, err := runProfileCLI(); ran {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	a := app.New()
 	w := a.NewWindow("Touchy Tails")
+	mainWindow = w
 	setupIcons(a, w)
 
-	console := newConsole(100)
-	deviceListVBox := container.NewVBox()
+	console := newConsole(openLogs(configPath))
+	deviceView = newDeviceList(console)
 	discoverBtn := widget.NewButton("Discover Devices", func() {
-		postGUI(func() { console.append("Discovery triggered") })
-		go bleScan(console, deviceListVBox)
+		console.Append("Discovery triggered")
+		go bleScan(console)
+	})
+	exportBtn := widget.NewButton("Export Profile", func() {
+		exportProfileDialog(w, console)
+	})
+	importBtn := widget.NewButton("Import Profile", func() {
+		importProfileDialog(w, console)
 	})
-	setupGUI(w, console, deviceListVBox, discoverBtn)
+	var oscStatus *oscPanel
+	oscStatus = newOSCPanel(defaultOSCPort, func(port int) {
+		startOSC(console, oscStatus, port)
+	})
+	outputView = newOutputPanel()
+	setupGUI(w, console, []*widget.Button{discoverBtn, exportBtn, importBtn}, oscStatus, outputView)
 
-	loadDevices(console, deviceListVBox)
+	if migratedFrom != "" {
+		console.Append("Migrated " + migratedFrom + " to " + configPath)
+	}
+	loadDevices(console)
+	hasTray := setupTray(a, w, console, outputView)
+	registerStopHotkey(console)
 	startRuntimeManagers(console)
-
-	w.ShowAndRun()
+	watchConfig(w, console)
+	startOSC(console, oscStatus, defaultOSCPort)
+	startAPI(console)
+	startBHaptics(console)
+
+	if hasTray && store.Settings().StartMinimized {
+		console.Append("Started minimized, open the window from the system tray")
+		a.Run()
+	} else {
+		w.ShowAndRun()
+	}
+	shutdown()
 }
 
 // ------------------- Initialization Helpers -------------------
 
+// openLogs creates the console log store, writing to logs/ next to the
+// config file
+func openLogs(configPath string) *logstore.Store {
+	logs := logstore.New(logCapacity)
+	f, err := logstore.OpenRotatingFile(filepath.Join(filepath.Dir(configPath), "logs", "touchytails.log"), logMaxSize, logKeep)
+	if err != nil {
+		log.Println("Log file unavailable:", err)
+		return logs
+	}
+	logFile = f
+	logs.SetFile(f)
+	return logs
+}
+
 func setupIcons(a fyne.App, w fyne.Window) {
 	iconRes := fyne.NewStaticResource("icon.png", iconData)
 	a.SetIcon(iconRes)
 	w.SetIcon(iconRes)
 }
 
-func setupGUI(w fyne.Window, console *Console, deviceListVBox *fyne.Container, discoverBtn *widget.Button) {
-	consoleScroll := container.NewVScroll(console.widget)
-	consoleScroll.SetMinSize(fyne.NewSize(0, 200))
-
-	deviceListScroll := container.NewVScroll(deviceListVBox)
-	deviceListScroll.SetMinSize(fyne.NewSize(0, 300))
-
-	buttonBox := container.NewHBox(discoverBtn)
+func setupGUI(w fyne.Window, console *Console, buttons []*widget.Button, oscStatus *oscPanel, outputCtl *outputPanel) {
+	consoleView := console.object(200)
 
-	mainUI := container.NewVBox(
-		deviceListScroll,
-		buttonBox, // <- add the button here
-		consoleScroll,
+	bodyView = newBodyMap(store, console)
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Devices", deviceView.object()),
+		container.NewTabItem("Body Map", bodyView),
 	)
+
+	buttonBox := container.NewHBox()
+	for _, btn := range buttons {
+		buttonBox.Add(btn)
+	}
+	buttonBox.Add(layout.NewSpacer())
+	buttonBox.Add(oscStatus.object())
+
+	// Main menu shortcuts fire even while an entry has focus
+	stopItem := fyne.NewMenuItem("Stop All", outputCtl.stopAll)
+	stopItem.Shortcut = stopAllShortcut
+	apiItem := fyne.NewMenuItem("Local API...", func() { showAPISettings(console) })
+	statusItem := fyne.NewMenuItem("VRChat status...", showStatusSettings)
+	bhapticsItem := fyne.NewMenuItem("bHaptics bridge...", func() { showBHapticsSettings(console) })
+	w.SetMainMenu(fyne.NewMainMenu(
+		fyne.NewMenu("Output", stopItem),
+		fyne.NewMenu("Settings", apiItem, statusItem, bhapticsItem),
+	))
+
+	mainUI := container.NewBorder(nil, container.NewVBox(outputCtl.object(), buttonBox, consoleView), nil, nil, tabs)
 	w.SetContent(mainUI)
-	w.Resize(fyne.NewSize(800, 550))
+	w.Resize(fyne.NewSize(800, 700))
 }
 
 // ------------------- Device Loading -------------------
 
-func loadDevices(console *Console, deviceListVBox *fyne.Container) {
+func loadDevices(console *Console) {
 	if err := store.Load(); err != nil {
-		postGUI(func() { console.append("Failed to load devices: " + err.Error()) })
+		console.Log(logstore.LevelError, "", "config", "Failed to load devices: "+err.Error())
 	}
+	console.Log(logstore.LevelInfo, "", "config", fmt.Sprintf("Loaded %d devices from %s", store.Count(), store.Path()))
+}
 
-	// Normalize IDs (migration)
-	for _, dev := range store.All() {
-		dev.Status = newStatus("Pending")
-		dev.Status.Alignment = fyne.TextAlignCenter
-	}
-	store.Save()
-
-	postGUI(func() {
-		console.append(fmt.Sprintf("Loaded %d devices", len(store.All())))
-	})
-	refreshDevices(deviceListVBox, console, store)
+// watchConfig merges hand edits of devices.json into the running app and
+// warns when they replaced in-app changes that were not saved yet.
+func watchConfig(w fyne.Window, console *Console) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		err := store.Watch(appCtx, func(res devicestore.ReloadResult, err error) {
+			if err != nil {
+				console.Log(logstore.LevelWarn, "", "config", "Ignoring external edit of "+store.Path()+": "+err.Error())
+				return
+			}
+			console.Log(logstore.LevelInfo, "", "config", fmt.Sprintf("Reloaded %s: %d added, %d updated, %d removed",
+				store.Path(), len(res.Added), len(res.Updated), len(res.Removed)))
+			for _, err := range res.Invalid {
+				console.Log(logstore.LevelWarn, "", "config", "Kept the current value, the file's is invalid: "+err.Error())
+			}
+			if len(res.Conflicts) > 0 {
+				postGUI(func() {
+					dialog.ShowInformation("Devices changed on disk",
+						fmt.Sprintf("%s was edited outside the app while you had unsaved changes.\n"+
+							"The file's settings were applied to: %s", store.Path(), strings.Join(res.Conflicts, ", ")), w)
+				})
+			}
+		})
+		if err != nil {
+			console.Log(logstore.LevelWarn, "", "config", "Not watching "+store.Path()+" for changes: "+err.Error())
+		}
+	}()
 }
 
 // ------------------- BLE Discovery -------------------
 
-func bleScan(console *Console, deviceListVBox *fyne.Container) {
+func bleScan(console *Console) {
 	ble := blemanager.New()
 	ble.ScanDevice("TouchyTails", 5*time.Second,
-		func(msg string) { postGUI(func() { console.append(msg) }) },
-		func(addrStr string) { addDeviceFromBLE(console, deviceListVBox, addrStr) },
+		func(msg string) { console.Log(logstore.LevelInfo, "", "ble", msg) },
+		func(name, addrStr string, target bool) {
+			bus.Publish(eventbus.ScanResult{Name: name, Address: addrStr, Target: target})
+			if target {
+				addDeviceFromBLE(console, addrStr)
+			}
+		},
 	)
 }
 
-func addDeviceFromBLE(console *Console, deviceListVBox *fyne.Container, addrStr string) {
-	postGUI(func() { console.append("Found device: " + addrStr) })
+func addDeviceFromBLE(console *Console, addrStr string) {
+	runtimeMgr.MarkSeen(addrStr)
 
 	var addr bluetooth.Address
 	addr.Set(addrStr)
 
 	if store.Exists(addrStr) {
-		postGUI(func() { console.append("Device already exists, skipping: " + addrStr) })
+		console.Log(logstore.LevelDebug, "", "ble", "Device already exists, skipping: "+addrStr)
 		return
 	}
 
@@ -113,62 +241,147 @@ func addDeviceFromBLE(console *Console, deviceListVBox *fyne.Container, addrStr
 		ID:      addrStr,
 		Name:    "Device " + letter,
 		Enabled: true,
-		Status:  newStatus("Pending"),
 	}
 	store.Add(dev)
-	store.Save()
-	refreshDevices(deviceListVBox, console, store)
+	store.ScheduleSave()
+	postGUI(func() { showSetupWizard(dev.ID, console) })
 }
 
 // ------------------- Runtime Managers -------------------
 
 func startRuntimeManagers(console *Console) {
-	// BLE runtime manager
-	runtimeMgr := devicestore.NewRuntimeManager(console)
-	runtimeMgr.Run(store)
+	store.OnSaveError(func(err error) {
+		console.Log(logstore.LevelError, "", "config", "Failed to save devices: "+err.Error())
+	})
 
-	// OSC manager
-	oscMgr := oscmanager.New("127.0.0.1:9001", oscChan)
-	go oscMgr.Run(func(msg string) {
-		console.append(msg)
+	// Device state changes, from the runtime manager or the GUI
+	store.OnStateChange(func(dev *devicestore.Device, from, to devicestore.State, reason string) {
+		bus.Publish(eventbus.DeviceStateChanged{
+			ID: dev.ID, Name: dev.Name, From: from.String(), To: to.String(), Reason: reason,
+		})
 	})
 
-	// OSC processor
-	go processOSC(console)
+	// BLE runtime manager
+	runtimeMgr = devicestore.NewRuntimeManager(bus, devicestore.BLEConnector, devicestore.SystemClock{})
+	runtimeMgr.Run(appCtx, store)
+
+	// Output manager: clears limit indicators once devices go quiet
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		output.Run(appCtx)
+	}()
+
+	// Event subscribers: the UI model, the process log and VRChat status
+	uiEvents, _ := bus.Subscribe(100)
+	logEvents, _ := bus.Subscribe(100)
+	statusEvents, _ := bus.Subscribe(100)
+	background.Add(3)
+	go func() {
+		defer background.Done()
+		ui.Run(appCtx, uiEvents, console)
+	}()
+	go func() {
+		defer background.Done()
+		logBusEvents(logEvents)
+	}()
+	go func() {
+		defer background.Done()
+		publishStatus(appCtx, statusEvents, console)
+	}()
+
+	// OSC processors: avatar parameters and TouchyTails commands
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		processOSC(console)
+	}()
+	go func() {
+		defer background.Done()
+		processOSCCommands(console)
+	}()
+}
+
+// startOSC starts the OSC listener on the given port. A failure, such as the
+// port being taken, is shown in the OSC panel instead of ending the app.
+func startOSC(console *Console, panel *oscPanel, port int) {
+	addr := fmt.Sprintf("%s:%d", oscHost, port)
+	oscMgr := oscmanager.New(addr, oscChan, oscCmdChan)
+	if err := oscMgr.Listen(); err != nil {
+		console.Log(logstore.LevelError, "", "osc", "OSC listener failed: "+err.Error())
+		postGUI(func() { panel.setFailed(err) })
+		return
+	}
+	postGUI(func() { panel.setListening(addr) })
 
-	// GUI updater
+	background.Add(1)
 	go func() {
-		for job := range guiChan {
-			job()
+		defer background.Done()
+		err := oscMgr.Serve(appCtx, func(msg string) {
+			console.Log(logstore.LevelInfo, "", "osc", msg)
+		})
+		if err != nil {
+			console.Log(logstore.LevelError, "", "osc", "OSC listener stopped: "+err.Error())
+			postGUI(func() { panel.setFailed(err) })
 		}
 	}()
 }
 
+// shutdown cancels every background worker and waits for devices to get
+// their stop command and disconnect, so nothing keeps running after exit.
+func shutdown() {
+	stopApp()
+	if !runtimeMgr.Wait(shutdownTimeout) {
+		log.Println("Timed out waiting for devices to disconnect")
+	}
+	background.Wait()
+	if err := store.Flush(); err != nil {
+		log.Println("Failed to save devices:", err)
+	}
+	if logFile != nil {
+		logFile.Close()
+	}
+}
+
+// logBusEvents writes state changes and failures to the process log.
+// Output and OSC events are left out, they come in by the hundred per
+// second while VRChat is running.
+func logBusEvents(events <-chan eventbus.Event) {
+	for {
+		select {
+		case <-appCtx.Done():
+			return
+		case e := <-events:
+			switch e.(type) {
+			case eventbus.DeviceStateChanged, eventbus.TransitionRejected, eventbus.ConnectFailed,
+				eventbus.SendFailed, eventbus.PanicStop:
+				log.Println(e)
+			}
+		}
+	}
+}
+
 // ------------------- OSC Handling -------------------
 
 func processOSC(console *Console) {
-	for msg := range oscChan {
+	for {
+		var msg oscmanager.OSCMessage
+		select {
+		case <-appCtx.Done():
+			return
+		case msg = <-oscChan:
+		}
+		bus.Publish(eventbus.OSCReceived{Name: msg.Name, Value: msg.Value})
 		if msg.Value <= 0 {
 			continue
 		}
-		valueStr := fmt.Sprintf("%.2f", mapOSCValue(msg.Value))
-
-		for _, dev := range store.All() {
-			if !dev.Enabled || !dev.Online || dev.Event != msg.Name || dev.BLEPtr == nil {
-				continue
-			}
-			dev.BLEPtr.Send(valueStr)
-			postGUI(func() {
-				console.append(fmt.Sprintf("%s: %s -> %s", dev.Name, dev.Event, valueStr))
-			})
+		if output.Muted() {
+			continue
 		}
-	}
-}
 
-func mapOSCValue(val float32) float32 {
-	mapped := 0.4 + val*0.6
-	if mapped < 0.4 {
-		mapped = 0.4
+		for _, dev := range store.Targets(msg.Name) {
+			// failures are published on the bus by the output manager
+			output.Send(dev.Device, dev.Mapping.Apply(msg.Value)*dev.Scale, msg.Name)
+		}
 	}
-	return mapped
 }
@@ -0,0 +1,139 @@
+// osccommands.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"touchytails/devicestore"
+	"touchytails/logstore"
+	"touchytails/oscmanager"
+	"touchytails/outputmanager"
+)
+
+// --- TouchyTails OSC commands ---
+
+// maxOSCHold caps the seconds argument of an intensity command
+const maxOSCHold = 60 * time.Second
+
+var oscCmdChan = make(chan oscmanager.Command, 64)
+
+// processOSCCommands runs commands from the /touchytails/ namespace until
+// the app closes
+func processOSCCommands(console *Console) {
+	for {
+		select {
+		case <-appCtx.Done():
+			return
+		case cmd := <-oscCmdChan:
+			runOSCCommand(console, cmd)
+		}
+	}
+}
+
+func runOSCCommand(console *Console, cmd oscmanager.Command) {
+	console.Log(logstore.LevelDebug, "", "osc", fmt.Sprintf("%s %v", cmd.Address, cmd.Args))
+	if cmd.Action == "panic" {
+		output.Panic()
+		return
+	}
+
+	// run sends the command to one target
+	var run func(t devicestore.Target) error
+	source := "OSC " + cmd.Address
+	switch cmd.Action {
+	case "intensity":
+		value, ok := oscFloat(cmd.Args, 0)
+		if !ok {
+			console.Log(logstore.LevelWarn, "", "osc", cmd.Address+": expects a value between 0 and 1")
+			return
+		}
+		value = max(0, min(1, value))
+		secs, _ := oscFloat(cmd.Args, 1)
+		hold := min(maxOSCHold, time.Duration(float64(secs)*float64(time.Second)))
+		run = func(t devicestore.Target) error {
+			return output.Trigger(appCtx, t.ID, value, t.Scale, hold, source)
+		}
+	case "pattern":
+		var name string
+		if len(cmd.Args) > 0 {
+			name, _ = cmd.Args[0].(string)
+		}
+		if name == "" {
+			console.Log(logstore.LevelWarn, "", "osc", fmt.Sprintf("%s: expects a pattern name, one of %s",
+				cmd.Address, strings.Join(outputmanager.PatternNames(), ", ")))
+			return
+		}
+		scale := float32(1)
+		if s, ok := oscFloat(cmd.Args, 1); ok {
+			scale = max(0, min(1, s))
+		}
+		run = func(t devicestore.Target) error {
+			return output.PlayNamed(appCtx, t.ID, name, scale*t.Scale, source)
+		}
+	default:
+		return
+	}
+
+	targets, err := oscCommandTargets(cmd)
+	if err != nil {
+		console.Log(logstore.LevelWarn, "", "osc", cmd.Address+": "+err.Error())
+		return
+	}
+	for _, t := range targets {
+		switch err := run(t); {
+		case err == nil:
+		case errors.Is(err, outputmanager.ErrMuted):
+			console.Log(logstore.LevelDebug, t.Name, "osc", cmd.Address+": output muted")
+		default:
+			console.Log(logstore.LevelWarn, t.Name, "osc", cmd.Address+": "+err.Error())
+		}
+	}
+}
+
+// oscCommandTargets returns the devices a command is for. OSC addresses
+// can't hold spaces, so "_" in a name also matches a space.
+func oscCommandTargets(cmd oscmanager.Command) ([]devicestore.Target, error) {
+	names := []string{cmd.Name}
+	if spaced := strings.ReplaceAll(cmd.Name, "_", " "); spaced != cmd.Name {
+		names = append(names, spaced)
+	}
+	for _, name := range names {
+		switch cmd.Target {
+		case "device":
+			if dev, ok := store.Lookup(name); ok {
+				return []devicestore.Target{{Device: dev, Scale: 1}}, nil
+			}
+		case "group":
+			if targets, ok := store.GroupTargets(name); ok {
+				return targets, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no %s named %q", cmd.Target, cmd.Name)
+}
+
+// oscFloat reads argument i as a number; OSC apps send floats, ints or
+// booleans for the same thing
+func oscFloat(args []any, i int) (float32, bool) {
+	if i >= len(args) {
+		return 0, false
+	}
+	switch v := args[i].(type) {
+	case float32:
+		return v, true
+	case float64:
+		return float32(v), true
+	case int32:
+		return float32(v), true
+	case int64:
+		return float32(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
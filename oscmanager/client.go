@@ -0,0 +1,42 @@
+package oscmanager
+
+import (
+	"strings"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+// Client sends avatar parameters to VRChat
+type Client struct {
+	client *osc.Client
+}
+
+// NewClient creates a Client sending to host:port; VRChat listens on 9000
+func NewClient(host string, port int) *Client {
+	return &Client{client: osc.NewClient(host, port)}
+}
+
+// Port returns the port the client sends to
+func (c *Client) Port() int {
+	return c.client.Port()
+}
+
+// SendParameter sets an avatar parameter. VRChat parameters take a bool,
+// an int32 or a float32.
+func (c *Client) SendParameter(name string, value any) error {
+	msg := osc.NewMessage(parameterPrefix + name)
+	msg.Append(value)
+	return c.client.Send(msg)
+}
+
+// ParameterName makes text usable in an avatar parameter name by dropping
+// everything but ASCII letters, digits and underscores, so "Device A"
+// becomes "DeviceA"
+func ParameterName(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, text)
+}
@@ -1,49 +1,97 @@
 package oscmanager
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"strings"
+	"syscall"
 
 	"github.com/hypebeast/go-osc/osc"
 )
 
+// ErrPortInUse is returned by Listen when another program owns the UDP port
+var ErrPortInUse = errors.New("port already in use")
+
+const (
+	parameterPrefix = "/avatar/parameters/"
+	commandPrefix   = "/touchytails/"
+)
+
 type OSCMessage struct {
 	Name  string
 	Value float32
 }
 
-// OSCManager holds the OSC server and a channel for touch events
+// Command is a message in the TouchyTails namespace, which lets other OSC
+// apps drive devices directly:
+//
+//	/touchytails/device/<name>/intensity  value [seconds]
+//	/touchytails/device/<name>/pattern    pattern [scale]
+//	/touchytails/group/<name>/intensity   value [seconds]
+//	/touchytails/group/<name>/pattern     pattern [scale]
+//	/touchytails/panic
+type Command struct {
+	Address string
+	Target  string // "device", "group", or empty for app-wide commands
+	Name    string // device or group name
+	Action  string // "intensity", "pattern" or "panic"
+	Args    []any
+}
+
+// OSCManager holds the OSC server and channels for touch events and
+// TouchyTails commands
 type OSCManager struct {
 	Addr    string
 	oscChan chan OSCMessage
+	cmdChan chan Command
 	server  *osc.Server
+	conn    net.PacketConn
 }
 
-// New creates a new OSCManager
-func New(addr string, oscChan chan OSCMessage) *OSCManager {
+// New creates a new OSCManager. Commands are dropped when cmdChan is nil.
+func New(addr string, oscChan chan OSCMessage, cmdChan chan Command) *OSCManager {
 	return &OSCManager{
 		Addr:    addr,
 		oscChan: oscChan,
+		cmdChan: cmdChan,
 	}
 }
 
-// Run starts the OSC server and listens for TailTouch messages
-func (o *OSCManager) Run(onEvent func(msg string)) {
-	dispatcher := osc.NewStandardDispatcher()
-
-	// Wildcard handler (optional for debugging)
-	// dispatcher.AddMsgHandler("*", func(msg *osc.Message) {
-	// 	fmt.Printf("Received OSC message: %s, Arguments: %v\n", msg.Address, msg.Arguments)
-	// })
+// Listen binds the UDP socket. It returns ErrPortInUse (wrapped) when the
+// port is taken, so callers can offer a retry or another port.
+func (o *OSCManager) Listen() error {
+	conn, err := net.ListenPacket("udp", o.Addr)
+	if err != nil {
+		if isAddrInUse(err) {
+			return fmt.Errorf("listen on %s: %w", o.Addr, ErrPortInUse)
+		}
+		return fmt.Errorf("listen on %s: %w", o.Addr, err)
+	}
+	o.conn = conn
+	return nil
+}
 
-	// TailTouch handler
-	dispatcher.AddMsgHandler("/avatar/parameters/*", func(msg *osc.Message) {
-		fmt.Printf("Received OSC message: %s\n", msg.Address)
-		fmt.Printf("Arguments: %v\n", msg.Arguments)
+// Serve dispatches TailTouch messages from the socket opened by Listen.
+// Cancelling ctx closes the UDP socket and makes Serve return nil.
+func (o *OSCManager) Serve(ctx context.Context, onEvent func(msg string)) error {
+	if o.conn == nil {
+		return errors.New("osc: Serve called before Listen")
+	}
+	dispatcher := osc.NewStandardDispatcher()
 
-		prefix := "/avatar/parameters/"
-		name := strings.TrimPrefix(msg.Address, prefix)
+	// go-osc only accepts exact addresses or "*" as a catch-all,
+	// so the prefixes are matched here.
+	err := dispatcher.AddMsgHandler("*", func(msg *osc.Message) {
+		if strings.HasPrefix(msg.Address, commandPrefix) {
+			o.dispatchCommand(msg, onEvent)
+			return
+		}
+		if !strings.HasPrefix(msg.Address, parameterPrefix) {
+			return
+		}
+		name := strings.TrimPrefix(msg.Address, parameterPrefix)
 
 		if len(msg.Arguments) > 0 {
 			if val, ok := msg.Arguments[0].(float32); ok {
@@ -55,23 +103,90 @@ func (o *OSCManager) Run(onEvent func(msg string)) {
 					// sent successfully
 				default:
 					// channel full: remove old value then insert new one
-					<-o.oscChan
-					o.oscChan <- OSCMessage{
-						Name:  name,
-						Value: val,
+					select {
+					case <-o.oscChan:
+					default:
+					}
+					select {
+					case o.oscChan <- OSCMessage{Name: name, Value: val}:
+					default:
 					}
 				}
 			}
 		}
 	})
+	if err != nil {
+		return err
+	}
 
 	o.server = &osc.Server{
 		Addr:       o.Addr,
 		Dispatcher: dispatcher,
 	}
 
-	onEvent(fmt.Sprintf("Listening for OSC on %s...\n", o.server.Addr))
-	if err := o.server.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	go func() {
+		<-ctx.Done()
+		o.conn.Close()
+	}()
+
+	onEvent(fmt.Sprintf("Listening for OSC on %s...", o.Addr))
+	if err := o.server.Serve(o.conn); err != nil && ctx.Err() == nil {
+		o.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// dispatchCommand passes a TouchyTails command on. Unlike parameter
+// updates, commands are not replaced by newer ones, so a full channel
+// drops the new command.
+func (o *OSCManager) dispatchCommand(msg *osc.Message, onEvent func(msg string)) {
+	cmd, ok := ParseCommand(msg.Address, msg.Arguments)
+	if !ok {
+		onEvent("Unknown TouchyTails OSC address " + msg.Address)
+		return
+	}
+	if o.cmdChan == nil {
+		return
+	}
+	select {
+	case o.cmdChan <- cmd:
+	default:
+		onEvent("Dropped OSC command " + msg.Address + ", too many at once")
+	}
+}
+
+// ParseCommand splits a TouchyTails address into a Command
+func ParseCommand(address string, args []any) (Command, bool) {
+	rest, ok := strings.CutPrefix(address, commandPrefix)
+	if !ok {
+		return Command{}, false
+	}
+	cmd := Command{Address: address, Args: args}
+	parts := strings.Split(rest, "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "panic":
+		cmd.Action = "panic"
+	case len(parts) == 3 && (parts[0] == "device" || parts[0] == "group") &&
+		parts[1] != "" && (parts[2] == "intensity" || parts[2] == "pattern"):
+		cmd.Target, cmd.Name, cmd.Action = parts[0], parts[1], parts[2]
+	default:
+		return Command{}, false
+	}
+	return cmd, true
+}
+
+// isAddrInUse recognises "address in use" on every platform. Windows
+// reports WSAEADDRINUSE (10048), which is not syscall.EADDRINUSE there.
+func isAddrInUse(err error) bool {
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return true
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) && errno == 10048 {
+		return true
 	}
+	msg := err.Error()
+	return strings.Contains(msg, "address already in use") ||
+		strings.Contains(msg, "Only one usage of each socket address")
 }
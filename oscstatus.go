@@ -0,0 +1,158 @@
+// oscstatus.go
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"touchytails/devicestore"
+	"touchytails/eventbus"
+	"touchytails/logstore"
+	"touchytails/oscmanager"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- OSC status output ---
+
+const (
+	defaultStatusPort   = 9000
+	defaultStatusPrefix = "TT_"
+	// statusResend is how often every status is sent again, since VRChat
+	// forgets parameters when the avatar changes
+	statusResend = 30 * time.Second
+)
+
+// statusRefresh asks the publisher to send everything again right away
+var statusRefresh = make(chan struct{}, 1)
+
+// statusConfig returns the status settings with defaults filled in
+func statusConfig() (enabled bool, port int, prefix string) {
+	st := store.Settings()
+	port, prefix = st.StatusPort, st.StatusPrefix
+	if port <= 0 {
+		port = defaultStatusPort
+	}
+	if prefix == "" {
+		prefix = defaultStatusPrefix
+	}
+	return st.StatusOSC, port, prefix
+}
+
+// statusParams returns the parameter names a device reports under. Names
+// without any usable character, e.g. all Japanese, fall back to the ID.
+func statusParams(prefix, name, id string) (online, battery string) {
+	base := oscmanager.ParameterName(name)
+	if base == "" {
+		base = oscmanager.ParameterName(id)
+	}
+	return prefix + base + "_Online", prefix + base + "_Battery"
+}
+
+// publishStatus sends <prefix><Name>_Online to VRChat whenever a device
+// changes state, and all of them every statusResend. Devices whose firmware
+// offers the Battery service (see BATTERY_PIN) send <prefix><Name>_Battery
+// as well.
+func publishStatus(ctx context.Context, events <-chan eventbus.Event, console *Console) {
+	var client *oscmanager.Client
+	failing := false // log a failing send once, not on every try
+
+	send := func(devices []devicestore.Device) {
+		enabled, port, prefix := statusConfig()
+		if !enabled {
+			return
+		}
+		if client == nil || client.Port() != port {
+			client = oscmanager.NewClient(oscHost, port)
+		}
+		for _, d := range devices {
+			online, battery := statusParams(prefix, d.Name, d.ID)
+			err := client.SendParameter(online, d.State.Connected())
+			if err == nil && d.HasBattery {
+				err = client.SendParameter(battery, d.Battery)
+			}
+			if err != nil && !failing {
+				console.Log(logstore.LevelWarn, "", "osc", "Sending status to VRChat failed: "+err.Error())
+			}
+			failing = err != nil
+		}
+	}
+
+	ticker := time.NewTicker(statusResend)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			send(store.Snapshot())
+		case <-statusRefresh:
+			send(store.Snapshot())
+		case e := <-events:
+			var id string
+			switch ev := e.(type) {
+			case eventbus.DeviceStateChanged:
+				id = ev.ID
+			case eventbus.DeviceConnected:
+				id = ev.ID
+			case eventbus.DeviceDisconnected:
+				id = ev.ID
+			case eventbus.BatteryChanged:
+				id = ev.ID
+			default:
+				continue
+			}
+			if dev, ok := store.Get(id); ok {
+				send([]devicestore.Device{dev})
+			}
+		}
+	}
+}
+
+// showStatusSettings lets the user switch the VRChat status parameters on
+// and off and pick their port and name prefix
+func showStatusSettings() {
+	enabledNow, port, prefix := statusConfig()
+	enabled := widget.NewCheck("Send device status to VRChat", nil)
+	enabled.SetChecked(enabledNow)
+
+	portEntry := widget.NewEntry()
+	portEntry.SetText(strconv.Itoa(port))
+	portEntry.Validator = func(text string) error {
+		_, err := parsePort(text)
+		return err
+	}
+
+	example := widget.NewLabel("")
+	prefixEntry := widget.NewEntry()
+	prefixEntry.OnChanged = func(text string) {
+		online, battery := statusParams(oscmanager.ParameterName(text), "Device A", "")
+		example.SetText("e.g. " + online + " (bool), " + battery + " (float)")
+	}
+	prefixEntry.SetText(prefix)
+
+	dialog.ShowForm("VRChat status", "Save", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("", enabled),
+			widget.NewFormItem("Port", portEntry),
+			widget.NewFormItem("Prefix", prefixEntry),
+			widget.NewFormItem("", example),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			p, _ := parsePort(portEntry.Text)
+			store.UpdateSettings(func(st *devicestore.Settings) {
+				st.StatusOSC = enabled.Checked
+				st.StatusPort = p
+				st.StatusPrefix = oscmanager.ParameterName(strings.TrimSpace(prefixEntry.Text))
+			})
+			select {
+			case statusRefresh <- struct{}{}:
+			default:
+			}
+		}, mainWindow)
+}
@@ -0,0 +1,123 @@
+package outputmanager
+
+import (
+	"fmt"
+	"time"
+	"touchytails/devicestore"
+)
+
+const (
+	// firmwareHold is how long the firmware keeps a value before it decays
+	firmwareHold = 500 * time.Millisecond
+	// cutoffRest is how long output stays off after the on-time limit hit
+	cutoffRest = 5 * time.Second
+	// noteHold keeps a limit indicator up so it doesn't flicker when values
+	// hover around a cap
+	noteHold = 2 * time.Second
+)
+
+// span is a period during which the device output was on
+type span struct {
+	start, end time.Time
+}
+
+// limiter tracks the output history of one device to enforce its Limits
+type limiter struct {
+	onSince   time.Time // start of the current continuous on period
+	lastOn    time.Time // when the output of the last write runs out
+	restUntil time.Time // output is blocked until then after a cutoff
+	spans     []span    // on periods within the duty window
+	note      string    // limit currently shown for the device
+	noteAt    time.Time // last time a limit applied
+}
+
+// apply runs value through the limits at time now. It returns the value to
+// send, a short note naming the limit that applied, and whether the value
+// is blocked. stop is true when the device is still on and must be
+// silenced right away.
+func (l *limiter) apply(lim devicestore.Limits, value float32, now time.Time) (out float32, note string, blocked, stop bool) {
+	on := now.Before(l.lastOn)
+
+	if now.Before(l.restUntil) {
+		return 0, "on-time cutoff", true, on
+	}
+	if lim.MaxDuty > 0 && l.onTime(now) >= time.Duration(float64(lim.MaxDuty)*float64(devicestore.DutyWindow)) {
+		return 0, "duty limit", true, on
+	}
+	if !on {
+		l.onSince = now
+	}
+	if maxOn := lim.MaxOn(); maxOn > 0 && now.Sub(l.onSince) >= maxOn {
+		l.restUntil = now.Add(cutoffRest)
+		return 0, "on-time cutoff", true, on
+	}
+	if lim.MaxIntensity > 0 && value > lim.MaxIntensity {
+		value = lim.MaxIntensity
+		note = fmt.Sprintf("max %.0f%%", lim.MaxIntensity*100)
+	}
+	l.record(now)
+	return value, note, false, false
+}
+
+// record notes that a value was written at now
+func (l *limiter) record(now time.Time) {
+	end := now.Add(firmwareHold)
+	if n := len(l.spans); n > 0 && !l.spans[n-1].end.Before(now) {
+		l.spans[n-1].end = end
+	} else {
+		l.spans = append(l.spans, span{start: now, end: end})
+	}
+	l.lastOn = end
+
+	// drop periods that left the duty window
+	cutoff := now.Add(-devicestore.DutyWindow)
+	i := 0
+	for i < len(l.spans) && l.spans[i].end.Before(cutoff) {
+		i++
+	}
+	l.spans = l.spans[i:]
+}
+
+// stopped notes that the device was silenced at now
+func (l *limiter) stopped(now time.Time) {
+	if now.Before(l.lastOn) {
+		l.lastOn = now
+	}
+	if n := len(l.spans); n > 0 && l.spans[n-1].end.After(now) {
+		l.spans[n-1].end = now
+	}
+}
+
+// onTime returns how long the output was on during the duty window
+func (l *limiter) onTime(now time.Time) time.Duration {
+	from := now.Add(-devicestore.DutyWindow)
+	var total time.Duration
+	for _, s := range l.spans {
+		start, end := s.start, s.end
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(now) {
+			end = now
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total
+}
+
+// setNote updates the limit indicator. It returns true when the shown
+// note changed. An empty note only clears the indicator after noteHold.
+func (l *limiter) setNote(note string, now time.Time) bool {
+	if note != "" {
+		l.noteAt = now
+	} else if l.note == "" || now.Sub(l.noteAt) < noteHold {
+		return false
+	}
+	if note == l.note {
+		return false
+	}
+	l.note = note
+	return true
+}
@@ -0,0 +1,174 @@
+package outputmanager
+
+import (
+	"testing"
+	"time"
+	"touchytails/devicestore"
+)
+
+// limitStep writes value at offset at and expects the limiter's answer
+type limitStep struct {
+	at      time.Duration
+	value   float32
+	out     float32
+	note    string
+	blocked bool
+	stop    bool
+}
+
+// passing returns steps from..to every interval that go through unchanged
+func passing(from, to, every time.Duration, value float32) []limitStep {
+	var steps []limitStep
+	for at := from; at <= to; at += every {
+		steps = append(steps, limitStep{at: at, value: value, out: value})
+	}
+	return steps
+}
+
+func steps(parts ...[]limitStep) []limitStep {
+	var out []limitStep
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestLimiterApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits devicestore.Limits
+		steps  []limitStep
+	}{
+		{
+			name:  "no limits",
+			steps: passing(0, 10*time.Second, time.Second, 1),
+		},
+		{
+			name:   "intensity cap",
+			limits: devicestore.Limits{MaxIntensity: 0.5},
+			steps: []limitStep{
+				{at: 0, value: 0.8, out: 0.5, note: "max 50%"},
+				{at: 100 * ms, value: 0.3, out: 0.3},
+				{at: 200 * ms, value: 0.5, out: 0.5},
+				{at: 300 * ms, value: 1, out: 0.5, note: "max 50%"},
+			},
+		},
+		{
+			name:   "on-time cutoff and rest",
+			limits: devicestore.Limits{MaxOnSeconds: 1},
+			steps: steps(
+				passing(0, 800*ms, 200*ms, 0.6),
+				[]limitStep{
+					// on for 1s: cut off while the last value still runs
+					{at: 1000 * ms, value: 0.6, note: "on-time cutoff", blocked: true, stop: true},
+					// resting; the device was silenced at the cutoff
+					{at: 1200 * ms, value: 0.6, note: "on-time cutoff", blocked: true},
+					{at: 5900 * ms, value: 0.6, note: "on-time cutoff", blocked: true},
+				},
+				// the rest is over and a new on period starts
+				passing(6000*ms, 6800*ms, 200*ms, 0.6),
+				[]limitStep{{at: 7000 * ms, value: 0.6, note: "on-time cutoff", blocked: true, stop: true}},
+			),
+		},
+		{
+			name:   "on-time resets after a pause",
+			limits: devicestore.Limits{MaxOnSeconds: 1},
+			steps: steps(
+				passing(0, 800*ms, 400*ms, 0.6),
+				// the last value ran out at 1300ms, so this starts anew
+				passing(1400*ms, 2200*ms, 400*ms, 0.6),
+			),
+		},
+		{
+			name:   "duty exhaustion and recovery",
+			limits: devicestore.Limits{MaxDuty: 0.05}, // 3s per minute
+			steps: steps(
+				passing(0, 2800*ms, 400*ms, 0.7),
+				[]limitStep{
+					{at: 3200 * ms, value: 0.7, note: "duty limit", blocked: true, stop: true},
+					{at: 30 * time.Second, value: 0.7, note: "duty limit", blocked: true},
+					// 2s..62s holds only 1.2s of the 3.2s on-time
+					{at: 62 * time.Second, value: 0.7, out: 0.7},
+				},
+			),
+		},
+		{
+			name:   "cap within duty",
+			limits: devicestore.Limits{MaxIntensity: 0.4, MaxDuty: 0.5},
+			steps: []limitStep{
+				{at: 0, value: 0.9, out: 0.4, note: "max 40%"},
+				{at: 400 * ms, value: 0.2, out: 0.2},
+			},
+		},
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &limiter{}
+			for _, st := range tt.steps {
+				now := start.Add(st.at)
+				out, note, blocked, stop := l.apply(tt.limits, st.value, now)
+				if stop {
+					l.stopped(now) // as Send does after writing the stop command
+				}
+				if out != st.out || note != st.note || blocked != st.blocked || stop != st.stop {
+					t.Fatalf("at %v: got %v %q blocked %v stop %v, want %v %q blocked %v stop %v",
+						st.at, out, note, blocked, stop, st.out, st.note, st.blocked, st.stop)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterOnTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := &limiter{}
+	l.record(start)
+	l.record(start.Add(300 * ms)) // extends the same span to 800ms
+	l.record(start.Add(2 * time.Second))
+	l.stopped(start.Add(2100 * ms))
+
+	tests := []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		{400 * ms, 400 * ms},
+		{time.Second, 800 * ms},
+		{3 * time.Second, 900 * ms},
+		{devicestore.DutyWindow + 500*ms, 400 * ms}, // 500..800ms of the first span is left
+		{devicestore.DutyWindow + 3*time.Second, 0},
+	}
+	for _, tt := range tests {
+		if got := l.onTime(start.Add(tt.at)); got != tt.want {
+			t.Errorf("onTime at %v = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterNote(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := &limiter{}
+	tests := []struct {
+		at      time.Duration
+		note    string
+		changed bool
+	}{
+		{0, "", false},
+		{0, "max 50%", true},
+		{100 * ms, "max 50%", false},
+		// values under the cap clear the indicator noteHold after the
+		// limit last applied
+		{time.Second, "", false},
+		{2 * time.Second, "", false},
+		{2100 * ms, "", true},
+		{2100 * ms, "", false},
+		{3 * time.Second, "duty limit", true},
+		{3100 * ms, "on-time cutoff", true},
+	}
+	for _, tt := range tests {
+		if got := l.setNote(tt.note, start.Add(tt.at)); got != tt.changed {
+			t.Errorf("setNote(%q) at %v = %v, want %v", tt.note, tt.at, got, tt.changed)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package outputmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"touchytails/blemanager"
+	"touchytails/devicestore"
+	"touchytails/eventbus"
+)
+
+var (
+	// ErrMuted is returned by Send while output is muted
+	ErrMuted = errors.New("output muted")
+	// ErrLimited is returned by Send when a device limit holds a value back
+	ErrLimited = errors.New("output held back by a device limit")
+)
+
+// OutputManager is the single path values take on their way to a device.
+// It applies the master intensity, the mute switch and the per-device
+// limits, records the result on the store and reports it on the bus.
+type OutputManager struct {
+	store *devicestore.DeviceStore
+	bus   *eventbus.Bus
+
+	mu       sync.Mutex
+	master   float32
+	muted    bool
+	limiters map[string]*limiter
+	stats    map[string]*deviceStats
+	patterns map[string]*playing
+}
+
+// New creates an OutputManager at full master intensity
+func New(store *devicestore.DeviceStore, bus *eventbus.Bus) *OutputManager {
+	return &OutputManager{
+		store:    store,
+		bus:      bus,
+		master:   1,
+		limiters: make(map[string]*limiter),
+		stats:    make(map[string]*deviceStats),
+		patterns: make(map[string]*playing),
+	}
+}
+
+// SetMaster sets the factor every value is scaled by, clamped to 0..1
+func (m *OutputManager) SetMaster(v float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.master = max(0, min(1, v))
+}
+
+// Master returns the current master intensity
+func (m *OutputManager) Master() float32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.master
+}
+
+// SetMuted blocks or allows output. Devices stay connected while muted.
+func (m *OutputManager) SetMuted(muted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.muted = muted
+}
+
+// Muted reports whether output is blocked
+func (m *OutputManager) Muted() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.muted
+}
+
+// Send scales value by the master intensity, applies the device limits and
+// writes it to the device. Source says what triggered the output and shows
+// up in the OutputSent event.
+func (m *OutputManager) Send(dev devicestore.Device, value float32, source string) error {
+	if dev.BLEPtr == nil || !dev.State.Connected() {
+		return blemanager.ErrNotReady
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	if m.muted {
+		m.mu.Unlock()
+		return ErrMuted
+	}
+	lim := m.limiterUnlocked(dev.ID)
+	value, note, blocked, stop := lim.apply(dev.Limits, value*m.master, now)
+	st := m.statsUnlocked(dev.ID)
+	st.limit, st.blocked, st.triedAt = note, blocked, now
+	if stop {
+		lim.stopped(now)
+		st.lastAt = time.Time{}
+	}
+	noteChanged := lim.setNote(note, now)
+	m.mu.Unlock()
+
+	if noteChanged {
+		m.bus.Publish(eventbus.LimitChanged{ID: dev.ID, Name: dev.Name, Limit: note})
+	}
+	if stop {
+		m.write(dev, blemanager.StopCommand)
+	}
+	if blocked {
+		return ErrLimited
+	}
+
+	if err := m.write(dev, fmt.Sprintf("%.2f", value)); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	st.recordWrite(value, now)
+	m.mu.Unlock()
+	m.bus.Publish(eventbus.OutputSent{ID: dev.ID, Name: dev.Name, Source: source, Value: value})
+	return nil
+}
+
+// Stop switches a device off right away. It works while muted.
+func (m *OutputManager) Stop(dev devicestore.Device) error {
+	if dev.BLEPtr == nil || !dev.State.Connected() {
+		return blemanager.ErrNotReady
+	}
+	now := time.Now()
+	m.mu.Lock()
+	m.limiterUnlocked(dev.ID).stopped(now)
+	m.statsUnlocked(dev.ID).lastAt = time.Time{}
+	m.mu.Unlock()
+	return m.write(dev, blemanager.StopCommand)
+}
+
+// write sends data to a device and records the result
+func (m *OutputManager) write(dev devicestore.Device, data string) error {
+	err := dev.BLEPtr.Send(data)
+	m.store.RecordSendResult(dev.ID, err)
+	if err != nil {
+		m.bus.Publish(eventbus.SendFailed{ID: dev.ID, Name: dev.Name, Data: data, Err: err})
+	}
+	return err
+}
+
+// Run clears limit indicators of devices that went quiet until ctx is done
+func (m *OutputManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var cleared []string
+			m.mu.Lock()
+			for id, lim := range m.limiters {
+				if lim.setNote("", now) {
+					cleared = append(cleared, id)
+				}
+			}
+			m.mu.Unlock()
+			for _, id := range cleared {
+				if dev, ok := m.store.Get(id); ok {
+					m.bus.Publish(eventbus.LimitChanged{ID: id, Name: dev.Name})
+				}
+			}
+		}
+	}
+}
+
+func (m *OutputManager) limiterUnlocked(id string) *limiter {
+	lim, ok := m.limiters[id]
+	if !ok {
+		lim = &limiter{}
+		m.limiters[id] = lim
+	}
+	return lim
+}
+
+// Panic mutes output, ends all patterns and writes the stop command to
+// every connected device at once. It returns after all writes finished or
+// timed out.
+func (m *OutputManager) Panic() {
+	m.mu.Lock()
+	m.muted = true
+	for _, st := range m.stats {
+		st.lastAt = time.Time{}
+	}
+	for id, run := range m.patterns {
+		run.cancel()
+		delete(m.patterns, id)
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stopped, failed := 0, 0
+	for _, dev := range m.store.Snapshot() {
+		if dev.BLEPtr == nil || !dev.State.Connected() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.write(dev, blemanager.StopCommand)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				return
+			}
+			stopped++
+		}()
+	}
+	wg.Wait()
+	m.bus.Publish(eventbus.PanicStop{Stopped: stopped, Failed: failed})
+}
@@ -0,0 +1,85 @@
+package outputmanager
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"touchytails/devicestore"
+	"touchytails/eventbus"
+)
+
+// fakeLink records writes and fails them with err
+type fakeLink struct {
+	mu   sync.Mutex
+	sent []string
+	err  error
+}
+
+func (l *fakeLink) ConnectDevice(string) error { return nil }
+func (l *fakeLink) Ready() bool                { return true }
+func (l *fakeLink) Battery() (float32, bool)   { return 0, false }
+func (l *fakeLink) Disconnect()                {}
+
+func (l *fakeLink) Send(data string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sent = append(l.sent, data)
+	return l.err
+}
+
+// newTestOutput returns an output manager with one online device on link
+func newTestOutput(t *testing.T, link *fakeLink) (*OutputManager, devicestore.Device, <-chan eventbus.Event) {
+	t.Helper()
+	store := devicestore.New(filepath.Join(t.TempDir(), "devices.json"))
+	store.Add(&devicestore.Device{ID: "dev", Name: "Tail", Enabled: true, State: devicestore.StateOnline})
+	store.SetBLE("dev", link)
+	bus := eventbus.New()
+	events, cancel := bus.Subscribe(10)
+	t.Cleanup(cancel)
+	dev, _ := store.Get("dev")
+	return New(store, bus), dev, events
+}
+
+func TestSendPublishesOutput(t *testing.T) {
+	link := &fakeLink{}
+	m, dev, events := newTestOutput(t, link)
+	m.SetMaster(0.5)
+	if err := m.Send(dev, 0.8, "TailTouch"); err != nil {
+		t.Fatal(err)
+	}
+	want := eventbus.OutputSent{ID: "dev", Name: "Tail", Source: "TailTouch", Value: 0.4}
+	if got := <-events; got != want {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if len(link.sent) != 1 || link.sent[0] != "0.40" {
+		t.Errorf("wrote %q, want [0.40]", link.sent)
+	}
+}
+
+func TestSendFailurePublishesError(t *testing.T) {
+	fail := errors.New("link lost")
+	m, dev, events := newTestOutput(t, &fakeLink{err: fail})
+	if err := m.Send(dev, 1, "TailTouch"); !errors.Is(err, fail) {
+		t.Fatalf("Send returned %v, want %v", err, fail)
+	}
+	got, ok := (<-events).(eventbus.SendFailed)
+	if !ok || got.ID != "dev" || got.Data != "1.00" || !errors.Is(got.Err, fail) {
+		t.Errorf("got %#v, want SendFailed for 1.00", got)
+	}
+	if len(events) != 0 {
+		t.Errorf("%d more events after the failure, want none", len(events))
+	}
+}
+
+func TestSendMutedWritesNothing(t *testing.T) {
+	link := &fakeLink{}
+	m, dev, events := newTestOutput(t, link)
+	m.SetMuted(true)
+	if err := m.Send(dev, 1, "TailTouch"); !errors.Is(err, ErrMuted) {
+		t.Fatalf("Send returned %v, want ErrMuted", err)
+	}
+	if len(link.sent) != 0 || len(events) != 0 {
+		t.Errorf("wrote %q and published %d events while muted", link.sent, len(events))
+	}
+}
@@ -0,0 +1,170 @@
+package outputmanager
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+	"touchytails/blemanager"
+)
+
+// refreshInterval is how often a value that should stay on is written
+// again, well within firmwareHold
+const refreshInterval = 100 * time.Millisecond
+
+// ErrUnknownPattern is returned for a pattern name that does not exist
+var ErrUnknownPattern = errors.New("unknown pattern")
+
+// Step holds Value for Duration. Values are 0..1 like OSC values and go
+// through the device mapping; 0 switches the device off.
+type Step struct {
+	Value    float32
+	Duration time.Duration
+}
+
+// Pattern is a sequence of steps played on a device
+type Pattern []Step
+
+const ms = time.Millisecond
+
+// Patterns are the built-in patterns by name
+var Patterns = map[string]Pattern{
+	"pulse":     {{1, 200 * ms}},
+	"double":    {{1, 150 * ms}, {0, 100 * ms}, {1, 150 * ms}},
+	"buzz":      {{1, time.Second}},
+	"heartbeat": {{0.6, 100 * ms}, {0, 120 * ms}, {1, 150 * ms}, {0, 630 * ms}, {0.6, 100 * ms}, {0, 120 * ms}, {1, 150 * ms}},
+	"ramp":      {{0.1, 100 * ms}, {0.2, 100 * ms}, {0.3, 100 * ms}, {0.4, 100 * ms}, {0.5, 100 * ms}, {0.6, 100 * ms}, {0.7, 100 * ms}, {0.8, 100 * ms}, {0.9, 100 * ms}, {1, 100 * ms}},
+	"wave":      {{0.2, 150 * ms}, {0.5, 150 * ms}, {0.8, 150 * ms}, {1, 150 * ms}, {0.8, 150 * ms}, {0.5, 150 * ms}, {0.2, 150 * ms}},
+}
+
+// PatternNames returns the names of the built-in patterns, sorted
+func PatternNames() []string {
+	names := make([]string, 0, len(Patterns))
+	for name := range Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Trigger sets a device to value, mapped through the device mapping and
+// scaled by scale. With a duration the value is held that long and then
+// switched off; without one it is written once and the firmware lets it
+// decay. A value of 0 switches the device off. A pattern running on the
+// device ends either way.
+func (m *OutputManager) Trigger(ctx context.Context, id string, value, scale float32, d time.Duration, source string) error {
+	if d > 0 && value > 0 {
+		return m.Play(ctx, id, Pattern{{value, d}}, scale, source)
+	}
+	m.endPattern(id, nil)
+	dev, ok := m.store.Get(id)
+	if !ok {
+		return blemanager.ErrNotReady
+	}
+	if value <= 0 {
+		return m.Stop(dev)
+	}
+	return m.Send(dev, dev.Mapping.Apply(value)*scale, source)
+}
+
+// PlayNamed plays one of the built-in patterns
+func (m *OutputManager) PlayNamed(ctx context.Context, id, name string, scale float32, source string) error {
+	p, ok := Patterns[name]
+	if !ok {
+		return ErrUnknownPattern
+	}
+	return m.Play(ctx, id, p, scale, source)
+}
+
+// Play runs a pattern on a device in the background, replacing the one
+// already running there. It stops early when ctx is done or a write does
+// not go through, e.g. because output got muted. A pattern that runs out
+// switches the device off.
+func (m *OutputManager) Play(ctx context.Context, id string, p Pattern, scale float32, source string) error {
+	if dev, ok := m.store.Get(id); !ok || dev.BLEPtr == nil || !dev.State.Connected() {
+		return blemanager.ErrNotReady
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	run := &playing{cancel: cancel}
+	m.endPattern(id, run)
+	go func() {
+		defer cancel()
+		m.play(ctx, id, p, scale, source)
+
+		// A pattern that was replaced or ended by a new value leaves the
+		// device to whatever took over
+		m.mu.Lock()
+		last := m.patterns[id] == run
+		if last {
+			delete(m.patterns, id)
+		}
+		m.mu.Unlock()
+		if dev, ok := m.store.Get(id); ok && last {
+			m.Stop(dev)
+		}
+	}()
+	return nil
+}
+
+func (m *OutputManager) play(ctx context.Context, id string, p Pattern, scale float32, source string) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for _, step := range p {
+		if !m.playStep(ctx, ticker, id, step, scale, source) {
+			return
+		}
+	}
+}
+
+// playStep holds one step, writing values again on every tick. It returns
+// false when the pattern must end early.
+func (m *OutputManager) playStep(ctx context.Context, ticker *time.Ticker, id string, step Step, scale float32, source string) bool {
+	end := time.NewTimer(step.Duration)
+	defer end.Stop()
+	refresh := ticker.C
+	if step.Value <= 0 {
+		refresh = nil // off stays off without rewriting it
+	}
+	for {
+		dev, ok := m.store.Get(id)
+		if !ok {
+			return false
+		}
+		var err error
+		if step.Value > 0 {
+			err = m.Send(dev, dev.Mapping.Apply(step.Value)*scale, source)
+		} else {
+			err = m.Stop(dev)
+		}
+		if err != nil {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-end.C:
+			return true
+		case <-refresh:
+		}
+	}
+}
+
+// playing is a pattern running on a device
+type playing struct {
+	cancel context.CancelFunc
+}
+
+// endPattern cancels the pattern running on a device and registers next,
+// which may be nil, in its place
+func (m *OutputManager) endPattern(id string, next *playing) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if run := m.patterns[id]; run != nil {
+		run.cancel()
+	}
+	if next == nil {
+		delete(m.patterns, id)
+	} else {
+		m.patterns[id] = next
+	}
+}
@@ -0,0 +1,78 @@
+package outputmanager
+
+import "time"
+
+// rateWindow is the period the send rate is averaged over
+const rateWindow = time.Second
+
+// Stats describe the recent output of one device
+type Stats struct {
+	// Value is the output level the device is at: the last value written,
+	// or 0 once the firmware let it decay
+	Value float32
+	// Rate is writes per second over the last rateWindow
+	Rate float32
+	// Limit names the limit that reduced or held back the latest value,
+	// empty if it went out as requested
+	Limit string
+	// Blocked is true when the latest value was held back entirely
+	Blocked bool
+}
+
+// deviceStats collects what Stats reports for one device
+type deviceStats struct {
+	value   float32
+	lastAt  time.Time
+	sends   []time.Time // write times within rateWindow
+	limit   string
+	blocked bool
+	triedAt time.Time // last Send for the device, written or not
+}
+
+func (s *deviceStats) recordWrite(value float32, now time.Time) {
+	s.value, s.lastAt = value, now
+	s.sends = append(s.sends, now)
+	s.prune(now)
+}
+
+func (s *deviceStats) prune(now time.Time) {
+	i := 0
+	for i < len(s.sends) && now.Sub(s.sends[i]) > rateWindow {
+		i++
+	}
+	s.sends = s.sends[i:]
+}
+
+func (s *deviceStats) snapshot(now time.Time) Stats {
+	s.prune(now)
+	st := Stats{Rate: float32(len(s.sends)) / float32(rateWindow.Seconds())}
+	if now.Sub(s.triedAt) < noteHold {
+		st.Limit, st.Blocked = s.limit, s.blocked
+	}
+	if now.Sub(s.lastAt) < firmwareHold {
+		st.Value = s.value
+	}
+	return st
+}
+
+// Stats returns the current output stats of every device that received
+// output, by device ID
+func (m *OutputManager) Stats() map[string]Stats {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]Stats, len(m.stats))
+	for id, s := range m.stats {
+		out[id] = s.snapshot(now)
+	}
+	return out
+}
+
+func (m *OutputManager) statsUnlocked(id string) *deviceStats {
+	s, ok := m.stats[id]
+	if !ok {
+		s = &deviceStats{}
+		m.stats[id] = s
+	}
+	return s
+}
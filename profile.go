@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"touchytails/devicestore"
+	"touchytails/logstore"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+var (
+	exportFlag  = flag.String("export", "", "write the device profile to this file and exit")
+	importFlag  = flag.String("import", "", "merge the device profile from this file and exit")
+	replaceFlag = flag.Bool("replace", false, "with --import, overwrite devices that already exist")
+	remapFlag   = flag.String("remap", "", "with --import, apply profile devices to local ones, overwriting them: OLD=NEW,OLD2=NEW2")
+)
+
+const addAsNew = "Add as new device"
+
+// ------------------- CLI -------------------
+
+// runProfileCLI handles --export and --import. It reports whether one of them
+// was given, in which case the app exits instead of opening a window.
+func runProfileCLI() (bool, error) {
+	if *exportFlag == "" && *importFlag == "" {
+		return false, nil
+	}
+	if err := store.Load(); err != nil {
+		return true, err
+	}
+
+	if *exportFlag != "" {
+		data, err := store.ExportProfile()
+		if err != nil {
+			return true, err
+		}
+		if err := os.WriteFile(*exportFlag, data, 0644); err != nil {
+			return true, err
+		}
+		fmt.Printf("Exported %d devices to %s\n", store.Count(), *exportFlag)
+	}
+
+	if *importFlag != "" {
+		data, err := os.ReadFile(*importFlag)
+		if err != nil {
+			return true, err
+		}
+		p, err := devicestore.DecodeProfile(data)
+		if err != nil {
+			return true, err
+		}
+		remap, err := parseRemap(*remapFlag)
+		if err != nil {
+			return true, err
+		}
+		opts := devicestore.ImportOptions{Conflict: devicestore.KeepExisting, Remap: remap}
+		if *replaceFlag {
+			opts.Conflict = devicestore.ReplaceExisting
+		}
+		res := store.Import(p, opts)
+		if err := store.Save(); err != nil {
+			return true, err
+		}
+		fmt.Printf("Imported %s: %s\n", *importFlag, res)
+		for _, err := range res.Invalid {
+			fmt.Printf("Not imported: %v\n", err)
+		}
+	}
+	return true, nil
+}
+
+func parseRemap(arg string) (map[string]string, error) {
+	remap := map[string]string{}
+	if strings.TrimSpace(arg) == "" {
+		return remap, nil
+	}
+	for _, pair := range strings.Split(arg, ",") {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			return nil, fmt.Errorf("invalid remap %q, want OLD=NEW", pair)
+		}
+		remap[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return remap, nil
+}
+
+// ------------------- GUI -------------------
+
+func exportProfileDialog(w fyne.Window, console *Console) {
+	d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+		if err != nil || wc == nil {
+			return
+		}
+		defer wc.Close()
+		data, err := store.ExportProfile()
+		if err == nil {
+			_, err = wc.Write(data)
+		}
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		console.Append("Exported profile to " + wc.URI().Path())
+	}, w)
+	d.SetFileName("touchytails-profile.json")
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+	d.Show()
+}
+
+func importProfileDialog(w fyne.Window, console *Console) {
+	d := dialog.NewFileOpen(func(rc fyne.URIReadCloser, err error) {
+		if err != nil || rc == nil {
+			return
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		p, err := devicestore.DecodeProfile(data)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("not a TouchyTails profile: %w", err), w)
+			return
+		}
+
+		source := rc.URI().Name()
+		askRemap(w, p, func(remap map[string]string) {
+			askConflict(w, p, remap, func(policy devicestore.ConflictPolicy) {
+				res := store.Import(p, devicestore.ImportOptions{Conflict: policy, Remap: remap})
+				if err := store.Save(); err != nil {
+					console.Append("Failed to save devices: " + err.Error())
+				}
+				console.Append(fmt.Sprintf("Imported %s: %s", source, res))
+				for _, err := range res.Invalid {
+					console.Log(logstore.LevelWarn, "", "profile", "Not imported: "+err.Error())
+				}
+			})
+		})
+	}, w)
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+	d.Show()
+}
+
+// askRemap offers to map profile devices that are unknown here onto local
+// devices the profile does not mention, e.g. the same rig built with other
+// boards. It calls next with the chosen mapping.
+func askRemap(w fyne.Window, p *devicestore.Profile, next func(map[string]string)) {
+	unmatched := store.Unmatched(p)
+
+	inProfile := map[string]bool{}
+	for _, d := range p.Devices {
+		inProfile[d.ID] = true
+	}
+	options := []string{addAsNew}
+	byOption := map[string]string{}
+	for _, d := range store.Snapshot() {
+		if inProfile[d.ID] {
+			continue
+		}
+		label := fmt.Sprintf("%s (%s)", d.Name, d.ID)
+		options = append(options, label)
+		byOption[label] = d.ID
+	}
+
+	if len(unmatched) == 0 || len(options) == 1 {
+		next(nil)
+		return
+	}
+
+	selects := make([]*widget.Select, len(unmatched))
+	items := make([]*widget.FormItem, len(unmatched))
+	for i, d := range unmatched {
+		selects[i] = widget.NewSelect(options, nil)
+		selects[i].SetSelected(addAsNew)
+		items[i] = widget.NewFormItem(fmt.Sprintf("%s (%s)", d.Name, d.ID), selects[i])
+	}
+
+	dialog.ShowForm("Apply profile to these devices?", "Continue", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		remap := map[string]string{}
+		used := map[string]bool{}
+		for i, d := range unmatched {
+			to := byOption[selects[i].Selected]
+			if to == "" {
+				continue
+			}
+			if used[to] {
+				dialog.ShowError(errors.New("each local device can only be used once"), w)
+				return
+			}
+			used[to] = true
+			remap[d.ID] = to
+		}
+		next(remap)
+	}, w)
+}
+
+// askConflict asks whether existing devices should be overwritten
+func askConflict(w fyne.Window, p *devicestore.Profile, remap map[string]string, next func(devicestore.ConflictPolicy)) {
+	conflicts := store.Conflicts(p, remap)
+	if len(conflicts) == 0 {
+		next(devicestore.KeepExisting)
+		return
+	}
+	msg := fmt.Sprintf("%d device(s) in the profile already exist.\nReplace their settings with the profile's?", len(conflicts))
+	dialog.ShowCustomConfirm("Devices already exist", "Replace", "Keep mine", widget.NewLabel(msg), func(replace bool) {
+		if replace {
+			next(devicestore.ReplaceExisting)
+		} else {
+			next(devicestore.KeepExisting)
+		}
+	}, w)
+}
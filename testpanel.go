@@ -0,0 +1,327 @@
+// testpanel.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"touchytails/devicestore"
+	"touchytails/logstore"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- Test panel ---
+
+const (
+	// streamInterval is how often a held value is written again, well within
+	// the time the firmware keeps a value
+	streamInterval = 100 * time.Millisecond
+	// sweepTime is how long a sweep takes from 0 to full output
+	sweepTime = 15 * time.Second
+	// holdLimit ends a held stream even if the release never arrives
+	holdLimit = 10 * time.Second
+)
+
+// pulseLengths are the fixed pulses the test panel offers
+var pulseLengths = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// testPanel streams chosen levels to one device so its motor can be tried
+// out and its start threshold found. One stream runs at a time; starting
+// another or closing the panel stops it.
+type testPanel struct {
+	id      string
+	console *Console
+	out     *streamer
+	level   *levelPicker
+
+	sweepLabel *widget.Label
+	minLabel   *widget.Label
+	sweepBtn   *widget.Button
+	feltBtn    *widget.Button
+
+	mu    sync.Mutex
+	swept float32 // sweep level last sent, before master and limits
+}
+
+// showTestPanel opens the test panel of a device
+func showTestPanel(id string, console *Console) {
+	dev, ok := store.Get(id)
+	if !ok {
+		return
+	}
+	p := &testPanel{
+		id:         id,
+		console:    console,
+		sweepLabel: widget.NewLabel("Not running"),
+		minLabel:   widget.NewLabel(""),
+	}
+	p.out = newStreamer(id, console, p.sweepDone)
+	p.level = newLevelPicker(p.out, "Test hold", testPulseValue)
+	p.showMin(dev.Mapping)
+
+	buttons := []fyne.CanvasObject{p.level.hold}
+	for _, length := range pulseLengths {
+		buttons = append(buttons, widget.NewButton(length.String(), func() {
+			p.out.start("Test pulse", length, func(time.Duration) float32 { return p.level.value() })
+		}))
+	}
+
+	p.sweepBtn = widget.NewButton("Start sweep", p.startSweep)
+	p.feltBtn = widget.NewButton("Felt it", p.felt)
+	p.feltBtn.Importance = widget.HighImportance
+	p.feltBtn.Disable()
+	resetBtn := widget.NewButton("Use default", func() { p.saveMin(0) })
+
+	var d dialog.Dialog
+	wizardBtn := widget.NewButton("Setup wizard...", func() {
+		d.Hide()
+		showSetupWizard(id, console)
+	})
+
+	content := container.NewVBox(
+		widget.NewLabelWithStyle("Intensity", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		p.level.slider,
+		container.NewGridWithColumns(len(buttons), buttons...),
+		widget.NewSeparator(),
+		widget.NewLabelWithStyle("Start threshold", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabel("The sweep ramps from 0 to full output.\nPress \"Felt it\" as soon as the motor starts."),
+		container.NewHBox(p.sweepBtn, p.feltBtn, p.sweepLabel),
+		container.NewHBox(p.minLabel, resetBtn),
+		widget.NewSeparator(),
+		wizardBtn,
+	)
+
+	d = dialog.NewCustom("Test "+dev.Name, "Close", content, mainWindow)
+	d.SetOnClosed(p.out.stop)
+	d.Show()
+}
+
+// --- Sweep ---
+
+// startSweep ramps the output from 0 to 1 over sweepTime. GUI thread only.
+func (p *testPanel) startSweep() {
+	p.setSwept(0)
+	p.out.start("Test sweep", sweepTime, func(elapsed time.Duration) float32 {
+		v := min(1, float32(elapsed)/float32(sweepTime))
+		p.setSwept(v)
+		postGUI(func() {
+			// a late update must not replace the result once the sweep ended
+			if !p.feltBtn.Disabled() {
+				p.sweepLabel.SetText(fmt.Sprintf("At %.0f%%", v*100))
+			}
+		})
+		return v
+	})
+	p.sweepBtn.Disable()
+	p.feltBtn.Enable()
+}
+
+// felt stops the sweep and saves the level last sent as the minimum
+// intensity. Like the setup wizard it saves the level before the master
+// intensity and limits, the same scale the mapping works in. GUI thread only.
+func (p *testPanel) felt() {
+	p.out.stop()
+	p.mu.Lock()
+	level := p.swept
+	p.mu.Unlock()
+	if level <= 0 {
+		p.sweepLabel.SetText("Nothing was sent yet, try again")
+		return
+	}
+	p.sweepLabel.SetText(fmt.Sprintf("Felt at %.0f%%", level*100))
+	p.saveMin(level)
+}
+
+func (p *testPanel) setSwept(v float32) {
+	p.mu.Lock()
+	p.swept = v
+	p.mu.Unlock()
+}
+
+func (p *testPanel) sweepDone() {
+	p.sweepBtn.Enable()
+	p.feltBtn.Disable()
+}
+
+// saveMin stores the start threshold of the device; 0 means the default
+func (p *testPanel) saveMin(level float32) {
+	dev, ok := store.Get(p.id)
+	if !ok {
+		return
+	}
+	m := dev.Mapping
+	m.MinIntensity = level
+	if err := store.SetMapping(p.id, m); err != nil {
+		p.console.Log(logstore.LevelWarn, dev.Name, "mapping", "Minimum not saved: "+err.Error())
+		return
+	}
+	p.console.Log(logstore.LevelInfo, dev.Name, "mapping", fmt.Sprintf("Minimum intensity set to %.0f%%", m.Min()*100))
+	p.showMin(m)
+}
+
+func (p *testPanel) showMin(m devicestore.Mapping) {
+	text := fmt.Sprintf("Minimum: %.0f%%", m.Min()*100)
+	if m.MinIntensity <= 0 {
+		text += " (default)"
+	}
+	p.minLabel.SetText(text)
+}
+
+// --- Streams ---
+
+// streamer runs one output stream to a device at a time
+type streamer struct {
+	id      string
+	console *Console
+	onEnd   func() // runs on the GUI thread whenever a stream ends
+
+	// GUI thread only
+	stream context.Context    // running stream, nil if none
+	cancel context.CancelFunc // stops it
+}
+
+func newStreamer(id string, console *Console, onEnd func()) *streamer {
+	if onEnd == nil {
+		onEnd = func() {}
+	}
+	return &streamer{id: id, console: console, onEnd: onEnd}
+}
+
+// start streams value(elapsed) to the device for length, or until stopped,
+// then switches it off. GUI thread only.
+func (s *streamer) start(source string, length time.Duration, value func(elapsed time.Duration) float32) {
+	s.stop()
+	ctx, cancel := context.WithCancel(appCtx)
+	s.stream, s.cancel = ctx, cancel
+	go func() {
+		end := time.After(length)
+		ticker := time.NewTicker(streamInterval)
+		defer ticker.Stop()
+		begin := time.Now()
+	stream:
+		for sendTestPulse(s.console, s.id, value(time.Since(begin)), source) {
+			select {
+			case <-ctx.Done():
+				break stream
+			case <-end:
+				break stream
+			case <-ticker.C:
+			}
+		}
+		cancel()
+		if dev, ok := store.Get(s.id); ok {
+			output.Stop(dev)
+		}
+		postGUI(func() { s.streamEnded(ctx) })
+	}()
+}
+
+// stop ends the running stream, if any. GUI thread only.
+func (s *streamer) stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.stream, s.cancel = nil, nil
+	}
+	s.onEnd()
+}
+
+// streamEnded runs onEnd once the stream of ctx is over, unless a newer
+// stream already took its place. GUI thread only.
+func (s *streamer) streamEnded(ctx context.Context) {
+	if s.stream != ctx {
+		return
+	}
+	s.stream, s.cancel = nil, nil
+	s.onEnd()
+}
+
+// --- Level picker ---
+
+// levelPicker is an intensity slider with a button that streams the chosen
+// level while it is held, for at most holdLimit
+type levelPicker struct {
+	mu    sync.Mutex
+	level float32 // read by streams
+
+	slider fyne.CanvasObject
+	hold   *holdButton
+}
+
+func newLevelPicker(out *streamer, source string, initial float32) *levelPicker {
+	l := &levelPicker{}
+	percent := widget.NewLabel("")
+	slider := widget.NewSlider(0, 100)
+	slider.Step = 1
+	slider.OnChanged = func(v float64) {
+		l.mu.Lock()
+		l.level = float32(v / 100)
+		l.mu.Unlock()
+		percent.SetText(fmt.Sprintf("%3.0f%%", v))
+	}
+	slider.SetValue(float64(initial * 100))
+	l.slider = container.NewBorder(nil, nil, nil, percent, slider)
+	l.hold = newHoldButton("Hold to buzz",
+		func() { out.start(source, holdLimit, func(time.Duration) float32 { return l.value() }) },
+		out.stop)
+	return l
+}
+
+// value returns the chosen level, 0..1
+func (l *levelPicker) value() float32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level
+}
+
+// --- Hold button ---
+
+// holdButton is a button that reports press and release, for output that
+// runs while it is held down. Fyne sends the release to whatever is under
+// the pointer, so leaving the button counts as a release too.
+type holdButton struct {
+	widget.Button
+	onDown, onUp func()
+	pressed      bool
+}
+
+func newHoldButton(label string, onDown, onUp func()) *holdButton {
+	b := &holdButton{onDown: onDown, onUp: onUp}
+	b.Text = label
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+func (b *holdButton) MouseDown(ev *desktop.MouseEvent) {
+	if ev.Button != desktop.MouseButtonPrimary || b.pressed {
+		return
+	}
+	b.pressed = true
+	b.onDown()
+}
+
+func (b *holdButton) MouseUp(*desktop.MouseEvent) { b.release() }
+
+// MouseOut implements desktop.Hoverable
+func (b *holdButton) MouseOut() {
+	b.Button.MouseOut()
+	b.release()
+}
+
+func (b *holdButton) release() {
+	if !b.pressed {
+		return
+	}
+	b.pressed = false
+	b.onUp()
+}
@@ -0,0 +1,96 @@
+// tray.go
+package main
+
+import (
+	"touchytails/devicestore"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// --- System tray ---
+
+// tray is the system tray menu, nil where the platform has no tray
+var tray *trayMenu
+
+// trayMenu keeps the app reachable while the window is hidden: it shows
+// device status and offers mute, stop-all and window controls
+type trayMenu struct {
+	app       fyne.App
+	desk      desktop.App
+	w         fyne.Window
+	outputCtl *outputPanel
+}
+
+// setupTray installs the tray menu and makes closing the window hide it
+// instead of quitting, unless the user turned that off. It returns false
+// when the platform has no system tray.
+func setupTray(a fyne.App, w fyne.Window, console *Console, outputCtl *outputPanel) bool {
+	desk, ok := a.(desktop.App)
+	if !ok {
+		return false
+	}
+	tray = &trayMenu{app: a, desk: desk, w: w, outputCtl: outputCtl}
+	tray.refresh()
+
+	w.SetCloseIntercept(func() {
+		if store.Settings().QuitOnClose {
+			a.Quit()
+			return
+		}
+		w.Hide()
+		console.Append("Still running in the system tray; use Quit there to exit")
+	})
+	return true
+}
+
+// refresh rebuilds the tray menu from the current state. GUI thread only.
+func (t *trayMenu) refresh() {
+	if t == nil {
+		return
+	}
+	var items []*fyne.MenuItem
+
+	devices := store.Snapshot()
+	if len(devices) == 0 {
+		none := fyne.NewMenuItem("No devices", nil)
+		none.Disabled = true
+		items = append(items, none)
+	}
+	for _, d := range devices {
+		status := fyne.NewMenuItem(d.Name+": "+d.State.String(), nil)
+		status.Disabled = true
+		items = append(items, status)
+	}
+	items = append(items, fyne.NewMenuItemSeparator())
+
+	mute := fyne.NewMenuItem("Mute", func() {
+		t.outputCtl.mute.SetChecked(!output.Muted())
+	})
+	mute.Checked = output.Muted()
+	items = append(items, mute, fyne.NewMenuItem("Stop All", t.outputCtl.stopAll))
+	items = append(items, fyne.NewMenuItemSeparator())
+
+	settings := store.Settings()
+	startMin := fyne.NewMenuItem("Start minimized", func() {
+		store.UpdateSettings(func(st *devicestore.Settings) { st.StartMinimized = !st.StartMinimized })
+		t.refresh()
+	})
+	startMin.Checked = settings.StartMinimized
+	keep := fyne.NewMenuItem("Keep running when closed", func() {
+		store.UpdateSettings(func(st *devicestore.Settings) { st.QuitOnClose = !st.QuitOnClose })
+		t.refresh()
+	})
+	keep.Checked = !settings.QuitOnClose
+
+	quit := fyne.NewMenuItem("Quit", t.app.Quit)
+	quit.IsQuit = true
+	items = append(items,
+		fyne.NewMenuItem("Open Window", func() {
+			t.w.Show()
+			t.w.RequestFocus()
+		}),
+		startMin, keep, fyne.NewMenuItemSeparator(), quit)
+
+	t.desk.SetSystemTrayMenu(fyne.NewMenu("Touchy Tails", items...))
+}
@@ -0,0 +1,190 @@
+// uimodel.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"touchytails/eventbus"
+
+	"fyne.io/fyne/v2"
+)
+
+// --- UI model ---
+
+const (
+	// uiFrame is how often the window is brought up to date
+	uiFrame = 100 * time.Millisecond
+	// paramMemory is how long an OSC parameter counts as recently seen
+	paramMemory = 10 * time.Minute
+)
+
+// ui holds the state the window shows
+var ui = newUIModel()
+
+// uiModel sits between the rest of the app and the widgets. Producers only
+// record state here or in the store, which never waits for the GUI; on
+// every frame the model reads store snapshots and updates the widgets that
+// changed. At most one frame is queued at a time, so a flood of events
+// costs the GUI nothing extra.
+type uiModel struct {
+	mu      sync.Mutex
+	limits  map[string]string    // device ID -> limit reducing its output
+	outputs map[string]time.Time // device ID -> time of the last output
+	params  map[string]time.Time // OSC parameter -> time last received
+
+	queued atomic.Bool // a frame is waiting for the GUI thread
+
+	// GUI thread only
+	flashed map[string]time.Time
+	traySig string
+	bodySig string
+}
+
+func newUIModel() *uiModel {
+	return &uiModel{
+		limits:  make(map[string]string),
+		outputs: make(map[string]time.Time),
+		params:  make(map[string]time.Time),
+		flashed: make(map[string]time.Time),
+	}
+}
+
+// Run records bus events and renders frames until ctx is cancelled. Every
+// event is also written to the console log.
+func (m *uiModel) Run(ctx context.Context, events <-chan eventbus.Event, console *Console) {
+	ticker := time.NewTicker(uiFrame)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			m.record(e)
+			switch ev := e.(type) {
+			case eventbus.OSCReceived, eventbus.OutputSent:
+				continue // too frequent for the console
+			case eventbus.DeviceStateChanged:
+				if ev.Reason == "" {
+					continue // the connect/disconnect lines already say it
+				}
+			}
+			console.LogEvent(e)
+		case <-ticker.C:
+			if m.queued.CompareAndSwap(false, true) {
+				fyne.Do(func() {
+					m.queued.Store(false)
+					m.render(console)
+				})
+			}
+		}
+	}
+}
+
+func (m *uiModel) record(e eventbus.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch ev := e.(type) {
+	case eventbus.OutputSent:
+		m.outputs[ev.ID] = time.Now()
+	case eventbus.OSCReceived:
+		m.params[ev.Name] = time.Now()
+	case eventbus.LimitChanged:
+		if ev.Limit == "" {
+			delete(m.limits, ev.ID)
+		} else {
+			m.limits[ev.ID] = ev.Limit
+		}
+	}
+}
+
+// RecentParams returns the OSC parameters received within paramMemory,
+// most recent first
+func (m *uiModel) RecentParams() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	names := make([]string, 0, len(m.params))
+	for name, t := range m.params {
+		if now.Sub(t) > paramMemory {
+			delete(m.params, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := m.params[names[i]], m.params[names[j]]
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// render brings the widgets in line with the current state. GUI thread only.
+func (m *uiModel) render(console *Console) {
+	m.mu.Lock()
+	limits := make(map[string]string, len(m.limits))
+	for id, l := range m.limits {
+		limits[id] = l
+	}
+	var flash []string
+	for id, t := range m.outputs {
+		if t.After(m.flashed[id]) {
+			m.flashed[id] = t
+			flash = append(flash, id)
+		}
+	}
+	m.mu.Unlock()
+
+	if deviceView != nil {
+		deviceView.Sync(limits, output.Stats())
+	}
+	if outputView != nil {
+		outputView.sync()
+	}
+
+	devices := store.Snapshot()
+	var sig strings.Builder
+	var mapSig strings.Builder
+	for _, d := range devices {
+		sig.WriteString(d.Name + "\x00" + d.State.String() + "\x00")
+		mapSig.WriteString(d.ID + "\x00" + d.Name + "\x00")
+		if d.Position != nil {
+			fmt.Fprintf(&mapSig, "%g,%g", d.Position.X, d.Position.Y)
+		}
+		mapSig.WriteString("\x00")
+	}
+
+	if bodyView != nil {
+		if s := mapSig.String(); s != m.bodySig {
+			m.bodySig = s
+			bodyView.Sync()
+		}
+		for _, id := range flash {
+			bodyView.Flash(id)
+		}
+	}
+
+	// The tray menu is rebuilt only when something it shows changed
+	st := store.Settings()
+	sig.WriteString(boolSig(output.Muted()) + boolSig(st.StartMinimized) + boolSig(st.QuitOnClose))
+	if s := sig.String(); s != m.traySig {
+		m.traySig = s
+		tray.refresh()
+	}
+
+	console.update()
+}
+
+func boolSig(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
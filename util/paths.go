@@ -0,0 +1,24 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AppDirName is the folder created under the OS user config directory
+const AppDirName = "TouchyTails"
+
+// ConfigDir returns the per-user TouchyTails config directory, creating it if
+// needed: %AppData%\TouchyTails on Windows, ~/Library/Application Support/
+// TouchyTails on macOS and ~/.config/TouchyTails on Linux.
+func ConfigDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, AppDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
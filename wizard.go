@@ -0,0 +1,251 @@
+// wizard.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"touchytails/devicestore"
+	"touchytails/logstore"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// --- Setup wizard ---
+
+const notPlaced = "Not placed"
+
+// wizardStep is one page of the setup wizard. check, if set, must pass
+// before the wizard moves on.
+type wizardStep struct {
+	title string
+	body  fyne.CanvasObject
+	check func() error
+}
+
+// setupWizard walks the user through setting up a device: finding it,
+// naming it, placing it, measuring its intensity range and binding it to
+// an OSC parameter. Nothing is stored until the last step.
+type setupWizard struct {
+	id      string
+	console *Console
+	out     *streamer
+
+	steps []wizardStep
+	step  int
+
+	dlg    dialog.Dialog
+	title  *widget.Label
+	body   *fyne.Container
+	status *widget.Label
+	back   *widget.Button
+	next   *widget.Button
+
+	name   *widget.Entry
+	region *widget.Select
+	low    *levelPicker
+	high   *levelPicker
+	param  *widget.SelectEntry
+}
+
+// showSetupWizard opens the setup wizard of a device
+func showSetupWizard(id string, console *Console) {
+	dev, ok := store.Get(id)
+	if !ok {
+		return
+	}
+	w := &setupWizard{
+		id:      id,
+		console: console,
+		out:     newStreamer(id, console, nil),
+		title:   widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		body:    container.NewStack(),
+		status:  widget.NewLabel(""),
+	}
+	w.buildSteps(dev)
+
+	w.back = widget.NewButton("Back", func() { w.show(w.step - 1) })
+	w.next = widget.NewButton("Next", w.forward)
+	w.next.Importance = widget.HighImportance
+	cancel := widget.NewButton("Cancel", func() { w.dlg.Hide() })
+
+	content := container.NewBorder(
+		w.title,
+		container.NewVBox(w.status, container.NewHBox(cancel, w.back, w.next)),
+		nil, nil, w.body)
+	w.dlg = dialog.NewCustomWithoutButtons("Set up "+dev.Name, content, mainWindow)
+	w.dlg.SetOnClosed(w.out.stop)
+	w.dlg.Resize(fyne.NewSize(460, 360))
+	w.show(0)
+	w.dlg.Show()
+}
+
+func (w *setupWizard) buildSteps(dev devicestore.Device) {
+	buzz := widget.NewButton("Buzz", func() {
+		sendTestPulse(w.console, w.id, testPulseValue, "Setup")
+	})
+
+	w.name = widget.NewEntry()
+	w.name.SetText(dev.Name)
+	w.name.Validator = func(text string) error { return store.ValidateName(w.id, text) }
+
+	regions := []string{notPlaced}
+	for _, r := range bodyRegions {
+		regions = append(regions, r.name)
+	}
+	w.region = widget.NewSelect(regions, nil)
+	w.region.Selected = notPlaced
+	if dev.Position != nil {
+		if r := regionAt(*dev.Position); r != nil {
+			w.region.Selected = r.name
+		}
+	}
+
+	w.low = newLevelPicker(w.out, "Setup", dev.Mapping.Min())
+	w.high = newLevelPicker(w.out, "Setup", dev.Mapping.Max())
+
+	w.param = widget.NewSelectEntry(nil)
+	w.param.SetText(dev.Event)
+	w.param.Validator = devicestore.ValidateEvent
+	refresh := widget.NewButton("Refresh", w.refreshParams)
+	w.refreshParams()
+
+	w.steps = []wizardStep{
+		{
+			title: "Find the device",
+			body: container.NewVBox(
+				widget.NewLabel("Press Buzz and check which device vibrates.\nA new device may take a few seconds to connect."),
+				buzz,
+			),
+		},
+		{
+			title: "Name it",
+			body: container.NewVBox(
+				widget.NewLabel("Pick a name that says where the device sits."),
+				w.name,
+			),
+			check: w.name.Validate,
+		},
+		{
+			title: "Place it",
+			body: container.NewVBox(
+				widget.NewLabel("Where on the body is the device?\nYou can drag it to the exact spot on the body map later."),
+				w.region,
+			),
+		},
+		{
+			title: "Minimum intensity",
+			body: container.NewVBox(
+				widget.NewLabel("Hold the button and lower the level until\nyou can only just feel the device."),
+				w.low.slider,
+				w.low.hold,
+			),
+			check: func() error {
+				if w.low.value() <= 0 {
+					return errors.New("the minimum must be above 0%")
+				}
+				return nil
+			},
+		},
+		{
+			title: "Maximum intensity",
+			body: container.NewVBox(
+				widget.NewLabel("Hold the button and raise the level up to\nthe strongest that is still comfortable."),
+				w.high.slider,
+				w.high.hold,
+			),
+			check: func() error {
+				if w.high.value() < w.low.value() {
+					return fmt.Errorf("the maximum must be at least the minimum of %.0f%%", w.low.value()*100)
+				}
+				return nil
+			},
+		},
+		{
+			title: "OSC parameter",
+			body: container.NewVBox(
+				widget.NewLabel("Pick the avatar parameter that drives the device.\nTouch the spot in VRChat, then press Refresh to\nsee the parameters received most recently."),
+				container.NewBorder(nil, nil, nil, refresh, w.param),
+			),
+			check: w.param.Validate,
+		},
+	}
+}
+
+// show switches to step i. GUI thread only.
+func (w *setupWizard) show(i int) {
+	w.out.stop()
+	w.step = max(0, min(len(w.steps)-1, i))
+	s := w.steps[w.step]
+	w.title.SetText(fmt.Sprintf("Step %d of %d: %s", w.step+1, len(w.steps), s.title))
+	w.body.Objects = []fyne.CanvasObject{s.body}
+	w.body.Refresh()
+	w.status.SetText("")
+	if w.step == 0 {
+		w.back.Disable()
+	} else {
+		w.back.Enable()
+	}
+	if w.step == len(w.steps)-1 {
+		w.next.SetText("Finish")
+	} else {
+		w.next.SetText("Next")
+	}
+}
+
+// forward checks the current step and moves on, or saves on the last one
+func (w *setupWizard) forward() {
+	if check := w.steps[w.step].check; check != nil {
+		if err := check(); err != nil {
+			w.status.SetText(err.Error())
+			return
+		}
+	}
+	if w.step < len(w.steps)-1 {
+		w.show(w.step + 1)
+		return
+	}
+	if err := w.save(); err != nil {
+		w.status.SetText("Not saved: " + err.Error())
+		return
+	}
+	w.dlg.Hide()
+}
+
+// save writes everything the wizard collected to the store in one edit,
+// so nothing is stored if any of it is invalid
+func (w *setupWizard) save() error {
+	var m devicestore.Mapping
+	err := store.Edit(w.id, func(d *devicestore.Device) {
+		// A device stays where it was dragged unless it moved to another region
+		if d.Position == nil || regionAt(*d.Position) == nil || regionAt(*d.Position).name != w.region.Selected {
+			d.Position = nil
+			for _, r := range bodyRegions {
+				if r.name == w.region.Selected {
+					d.Position = &devicestore.Position{X: r.x + r.w/2, Y: r.y + r.h/2}
+				}
+			}
+		}
+		d.Mapping.MinIntensity, d.Mapping.MaxIntensity = w.low.value(), w.high.value()
+		m = d.Mapping
+		d.Name = w.name.Text
+		d.Event = w.param.Text
+	})
+	if err != nil {
+		return err
+	}
+	w.console.Log(logstore.LevelInfo, w.name.Text, "setup", fmt.Sprintf(
+		"Set up: %.0f%%-%.0f%%, bound to %q", m.Min()*100, m.Max()*100, w.param.Text))
+	return nil
+}
+
+// refreshParams offers the OSC parameters received most recently
+func (w *setupWizard) refreshParams() {
+	params := ui.RecentParams()
+	if len(params) > 20 {
+		params = params[:20]
+	}
+	w.param.SetOptions(params)
+}